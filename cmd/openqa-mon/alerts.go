@@ -0,0 +1,115 @@
+/* Alerts for jobs that remain in their state for an unusually long time */
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// AlertMonitor keeps track of how long jobs remain in their state and raises alerts for stuck jobs.
+// A job is alerted only once per state. The alert is cleared once the job changes its state
+type AlertMonitor struct {
+	Scheduled time.Duration // Alert if a job is scheduled for longer than this (0 = disabled)
+	Running   float64       // Alert if a job runs longer than this multiple of its usual duration (0 = disabled)
+	Uploading time.Duration // Alert if a job is uploading for longer than this (0 = disabled)
+
+	states map[jobKey]jobStateSince // Observed state of the jobs
+	mutex  sync.Mutex
+}
+
+// jobStateSince is the state of a job and the time when this state has been observed first
+type jobStateSince struct {
+	State  string
+	Since  time.Time
+	Reason string // Alert reason, if the job has been alerted in this state
+}
+
+// Alert is raised for a job, which remains in its state for an unusually long time
+type Alert struct {
+	Job    gopenqa.Job
+	Reason string
+}
+
+func CreateAlertMonitor() *AlertMonitor {
+	var am AlertMonitor
+	am.states = make(map[jobKey]jobStateSince, 0)
+	return &am
+}
+
+// Enabled returns true if at least one alert rule is enabled
+func (am *AlertMonitor) Enabled() bool {
+	return am.Scheduled > 0 || am.Running > 0 || am.Uploading > 0
+}
+
+// Check records the current state of the given job and returns the alert reason and true, if the job newly violates one of the alert rules
+func (am *AlertMonitor) Check(job gopenqa.Job, now time.Time) (string, bool) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	key := jobKey{Remote: job.Remote, ID: job.ID}
+	state, ok := am.states[key]
+	if !ok || state.State != job.JobState() {
+		state = jobStateSince{State: job.JobState(), Since: now}
+		am.states[key] = state
+	}
+	if state.Reason != "" {
+		return "", false
+	}
+	// Prefer the openQA timestamps over our own observations, if available
+	elapsed, ok := JobElapsed(job, now)
+	if !ok {
+		elapsed = now.Sub(state.Since)
+	}
+
+	reason := ""
+	switch job.State {
+	case "scheduled":
+		if am.Scheduled > 0 && elapsed > am.Scheduled {
+			reason = fmt.Sprintf("scheduled for %s", formatDuration(elapsed))
+		}
+	case "running":
+		if duration, ok := CachedScenarioDuration(job); ok && am.Running > 0 && elapsed.Seconds() > am.Running*duration.Seconds() {
+			reason = fmt.Sprintf("running for %s (usually %s)", formatDuration(elapsed), formatDuration(duration))
+		}
+	case "uploading":
+		// t_started refers to the start of the job, not of the upload
+		elapsed = now.Sub(state.Since)
+		if am.Uploading > 0 && elapsed > am.Uploading {
+			reason = fmt.Sprintf("uploading for %s", formatDuration(elapsed))
+		}
+	}
+	if reason == "" {
+		return "", false
+	}
+	state.Reason = reason
+	am.states[key] = state
+	return reason, true
+}
+
+// Alerted returns the alert reason and true, if the given job is alerted in its current state
+func (am *AlertMonitor) Alerted(job gopenqa.Job) (string, bool) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	state, ok := am.states[jobKey{Remote: job.Remote, ID: job.ID}]
+	if !ok || state.State != job.JobState() || state.Reason == "" {
+		return "", false
+	}
+	return state.Reason, true
+}
+
+// Prune forgets the observed states of all jobs that are not among the given jobs anymore
+func (am *AlertMonitor) Prune(jobs []gopenqa.Job) {
+	keys := make(map[jobKey]bool, len(jobs))
+	for _, job := range jobs {
+		keys[jobKey{Remote: job.Remote, ID: job.ID}] = true
+	}
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	for key := range am.states {
+		if !keys[key] {
+			delete(am.states, key)
+		}
+	}
+}
@@ -6,28 +6,88 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/os-autoinst/openqa-mon/internal"
 )
 
 type Config struct {
-	DefaultRemote string   // Default remote to take, if not otherwise defined
-	Continuous    int      // If >0, set continuous monitoring with this interval in seconds
-	Bell          bool     // bell enabled by default
-	Notify        bool     // notify enabled by default
-	Follow        bool     // follow jobs by default
-	Hierarchy     bool     // show hierarchy
-	HideStates    []string // hide the following job states
-	Quit          bool     // quit program, once all jobs are completed
-	Paused        bool     // Continuous monitoring pased
-	RabbitMQ      bool     // Use rabbitmq if possible
-	RabbitMQFiles []string // Additional RabbitMQ configuration files to be loaded
+	DefaultRemote      string                      // Default remote to take, if not otherwise defined
+	Continuous         int                         // If >0, set continuous monitoring with this interval in seconds
+	Workers            int                         // Maximum number of concurrent requests to the openQA instances
+	Retries            int                         // Maximum number of retries of failed requests (0 = disabled)
+	RetryDelay         float64                     // Delay before the first retry in seconds, doubled on every retry
+	AgeMarker          int                         // Mark jobs which have not been updated for this number of refreshes (0 = disabled)
+	Bell               bool                        // bell enabled by default
+	Notify             bool                        // notify enabled by default
+	Follow             bool                        // follow jobs by default
+	Hierarchy          bool                        // show hierarchy
+	HideStates         []string                    // hide the following job states
+	Quit               bool                        // quit program, once all jobs are completed
+	Paused             bool                        // Continuous monitoring pased
+	RabbitMQ           bool                        // Use rabbitmq if possible
+	Reconcile          int                         // Interval in seconds of the reconciliation polling in RabbitMQ mode (0 = no polling)
+	Hybrid             bool                        // RabbitMQ is available for all remotes, polling only reconciles missed updates
+	RabbitMQFiles      []string                    // Additional RabbitMQ configuration files to be loaded
+	Output             string                      // Output format for single-shot mode: "text", "json" or "ndjson"
+	EventLogFile       string                      // Append job state transitions to this file
+	MetricsListen      string                      // Serve Prometheus metrics on this address, if set
+	Daemon             bool                        // Run as daemon, controlled via the control socket
+	Attach             bool                        // Attach to a running daemon
+	Wait               bool                        // Wait until all jobs are done and print only their transitions, without TUI
+	Timeout            time.Duration               // Maximum time to wait for the jobs (0 = no timeout)
+	Exit               ExitPolicy                  // Which jobs count as failed and the resulting exit codes
+	AutoRestart        int                         // Restart incomplete jobs up to this number of times per original job (0 = disabled)
+	AutoRestartFailed  bool                        // Also restart failed jobs
+	Socket             string                      // Control socket of the daemon
+	JUnitFile          string                      // Write a JUnit XML report to this file when quitting
+	Format             string                      // User-defined text/template for job lines
+	AlertScheduled     int                         // Alert if a job is scheduled for more than this number of minutes (0 = disabled)
+	AlertRunning       float64                     // Alert if a job runs longer than this multiple of its usual duration (0 = disabled)
+	AlertUploading     int                         // Alert if a job is uploading for more than this number of minutes (0 = disabled)
+	Notifiers          internal.NotifierConfig     // Notification backends
+	NotificationRules  []internal.NotificationRule // Rules which jobs to notify about and via which backends
+	NotifyWindow       int                         // Coalesce notifications within this number of seconds into a summary (0 = per refresh)
+	NotifyMaxPerMinute int                         // Maximum number of notifications per minute (0 = unlimited)
 }
 
 type RabbitConfig struct {
-	Hostname string // OpenQA host this configuration belongs to
-	Remote   string // RabbitMQ server
-	Queue    string // Queue topic to subscribe on
-	Username string // RabbitMQ username
-	Password string // RabbitMQ password
+	Hostname string   // OpenQA host this configuration belongs to
+	Remote   string   // RabbitMQ server
+	Queue    string   // Prefix of the topics to subscribe on (e.g. opensuse.openqa)
+	Topics   []string // Additional topics to subscribe on (e.g. job.create)
+	Username string   // RabbitMQ username
+	Password string   // RabbitMQ password
+}
+
+// Topics that are always subscribed on. Note: Cancelled jobs are also included in "job.done"
+var defaultTopics = []string{"job.done", "job.restart"}
+
+// Topics that can be additionally subscribed on
+var extraTopics = []string{"job.create", "job.duplicate", "job.cancel", "comment.create"}
+
+// RoutingKeys returns the routing keys of the default and additional topics with the configured queue prefix.
+// Without a queue prefix, the topics of all openQA instances on the RabbitMQ server are matched
+func (rabbit *RabbitConfig) RoutingKeys() []string {
+	prefix := rabbit.Queue
+	if prefix == "" {
+		prefix = "#"
+	}
+	keys := make([]string, 0)
+	for _, topic := range unique(append(append([]string{}, defaultTopics...), rabbit.Topics...)) {
+		keys = append(keys, prefix+"."+topic)
+	}
+	return keys
+}
+
+// Returns the topic of the given routing key, or an empty string if the topic is not supported
+func rabbitTopic(key string) string {
+	for _, topic := range append(append([]string{}, defaultTopics...), extraTopics...) {
+		if strings.HasSuffix(key, "."+topic) {
+			return topic
+		}
+	}
+	return ""
 }
 
 func strBool(text string) (bool, error) {
@@ -57,6 +117,13 @@ func (cf *Config) SetDefaults() {
 	cf.Quit = false
 	cf.RabbitMQ = false // Disabled by default for now
 	cf.RabbitMQFiles = make([]string, 0)
+	cf.Reconcile = 300
+	cf.Output = "text"
+	cf.Exit = CreateExitPolicy()
+	cf.Workers = 4
+	cf.Retries = 3
+	cf.RetryDelay = 1
+	cf.AgeMarker = 2
 }
 
 // readConfig reads file configuration from filename (if exists) and sets the values accordingly
@@ -111,11 +178,116 @@ func (cf *Config) ReadFile(filename string) error {
 			if err != nil {
 				return fmt.Errorf("%s (Line %d)", err, iLine)
 			}
+		case "workers":
+			cf.Workers, err = strconv.Atoi(value)
+			if err != nil || cf.Workers < 1 {
+				return fmt.Errorf("invalid number of workers (Line %d)", iLine)
+			}
+		case "retries":
+			cf.Retries, err = strconv.Atoi(value)
+			if err != nil || cf.Retries < 0 {
+				return fmt.Errorf("invalid number of retries (Line %d)", iLine)
+			}
+		case "retrydelay":
+			cf.RetryDelay, err = strconv.ParseFloat(value, 64)
+			if err != nil || cf.RetryDelay < 0 {
+				return fmt.Errorf("invalid retry delay (Line %d)", iLine)
+			}
+		case "agemarker":
+			cf.AgeMarker, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "autorestart":
+			cf.AutoRestart, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "autorestartfailed":
+			cf.AutoRestartFailed, err = strBool(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "acceptresults":
+			cf.Exit.Accepted = filterEmpty(trimSplit(value, ","))
+		case "ignoreresults":
+			cf.Exit.Ignored = filterEmpty(trimSplit(value, ","))
+		case "exitfailed":
+			cf.Exit.Failed, err = parseExitCode(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "exitincomplete":
+			cf.Exit.Incomplete, err = parseExitCode(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "exittimeout":
+			cf.Exit.Timeout, err = parseExitCode(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
 		case "rabbitmq":
 			cf.RabbitMQ, err = strBool(value)
 			if err != nil {
 				return fmt.Errorf("%s (Line %d)", err, iLine)
 			}
+		case "reconcile":
+			cf.Reconcile, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "format":
+			cf.Format = value
+		case "socket":
+			cf.Socket = value
+		case "notifiers":
+			cf.Notifiers.Backends = filterEmpty(trimSplit(value, ","))
+		case "notifycommand":
+			cf.Notifiers.Command = value
+		case "notifywebhook":
+			cf.Notifiers.Webhook = value
+		case "smtpserver":
+			cf.Notifiers.SMTPServer = value
+		case "smtpusername":
+			cf.Notifiers.SMTPUsername = value
+		case "smtppassword":
+			cf.Notifiers.SMTPPassword = value
+		case "emailfrom":
+			cf.Notifiers.EmailFrom = value
+		case "emailto":
+			cf.Notifiers.EmailTo = filterEmpty(trimSplit(value, ","))
+		case "notifyrule":
+			rule, err := internal.ParseNotificationRule(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+			cf.NotificationRules = append(cf.NotificationRules, rule)
+		case "notifywindow":
+			cf.NotifyWindow, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "notifymaxperminute":
+			cf.NotifyMaxPerMinute, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "alertscheduled":
+			cf.AlertScheduled, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "alertrunning":
+			cf.AlertRunning, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
+		case "alertuploading":
+			cf.AlertUploading, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s (Line %d)", err, iLine)
+			}
 		default:
 			return fmt.Errorf("Config file illegal entry (Line %d)", iLine)
 		}
@@ -173,7 +345,14 @@ func ReadRabbitMQ(filename string) ([]RabbitConfig, error) {
 			case "remote":
 				rabbit.Remote = value
 			case "queue":
-				rabbit.Queue = value
+				rabbit.Queue = strings.TrimSuffix(value, ".")
+			case "topics":
+				rabbit.Topics = filterEmpty(trimSplit(value, ","))
+				for _, topic := range rabbit.Topics {
+					if rabbitTopic("."+topic) == "" {
+						return ret, fmt.Errorf("unsupported topic '%s' (Line %d)", topic, iLine)
+					}
+				}
 			case "username":
 				rabbit.Username = value
 			case "password":
@@ -0,0 +1,533 @@
+/* Daemon mode: a single monitoring engine, which is controlled via a json API on a unix socket */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+	"github.com/os-autoinst/openqa-mon/internal"
+)
+
+// DaemonRequest is a single json request line on the control socket
+type DaemonRequest struct {
+	Command string            `json:"command"`          // "add", "remove", "list", "refresh" or "subscribe"
+	Remote  string            `json:"remote,omitempty"` // Remote of the jobs to add or remove. Defaults to the DefaultRemote
+	Jobs    []int64           `json:"jobs,omitempty"`   // Job IDs to add or remove
+	Params  map[string]string `json:"params,omitempty"` // Overview query parameters to add (e.g. build, distri)
+}
+
+// DaemonResponse is a single json response line on the control socket. Subscriptions receive a response with the event for every transition and a response with the current jobs after every refresh or removal
+type DaemonResponse struct {
+	Error string        `json:"error,omitempty"`
+	Jobs  []gopenqa.Job `json:"jobs,omitempty"`  // Current jobs, for "list" and subscriptions
+	Event *Event        `json:"event,omitempty"` // Transition event, for subscriptions
+}
+
+// Number of updates that are buffered per subscriber. Subscribers that fall behind by more updates are disconnected
+const subscriberBuffer = 1024
+
+// Daemon monitors the jobs of all remotes and shares them with all clients
+type Daemon struct {
+	remotes     []Remote
+	generation  int // Incremented on every change of remotes
+	jobs        []gopenqa.Job
+	dropped     map[jobKey]bool // Jobs that have been removed
+	subscribers map[chan DaemonResponse]bool
+	refresh     chan int
+	mutex       sync.Mutex
+}
+
+// DefaultSocket returns the default path of the control socket
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "openqa-mon.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("openqa-mon-%d.sock", os.Getuid()))
+}
+
+func CreateDaemon(remotes []Remote) *Daemon {
+	var d Daemon
+	d.remotes = remotes
+	d.jobs = make([]gopenqa.Job, 0)
+	d.dropped = make(map[jobKey]bool, 0)
+	d.subscribers = make(map[chan DaemonResponse]bool, 0)
+	d.refresh = make(chan int, 1)
+	return &d
+}
+
+// Listen accepts clients on the given unix socket in the background
+func (d *Daemon) Listen(socket string) (net.Listener, error) {
+	if _, err := os.Stat(socket); err == nil {
+		// Refuse to replace the socket of a running daemon, but remove stale sockets
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("daemon already running on %s", socket)
+		}
+		os.Remove(socket)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return listener, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return listener, nil
+}
+
+// Serve the requests of a single client
+func (d *Daemon) serve(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req DaemonRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if err := encoder.Encode(DaemonResponse{Error: fmt.Sprintf("invalid request: %s", err)}); err != nil {
+				return
+			}
+			continue
+		}
+		if req.Command == "subscribe" {
+			d.serveSubscription(conn, encoder)
+			return
+		}
+		if err := encoder.Encode(d.Handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+// Send the current jobs and all subsequent updates to the client, until the client disconnects
+func (d *Daemon) serveSubscription(conn net.Conn, encoder *json.Encoder) {
+	updates := d.Subscribe()
+	defer d.Unsubscribe(updates)
+	closed := make(chan bool)
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+	if err := encoder.Encode(DaemonResponse{Jobs: d.Jobs()}); err != nil {
+		return
+	}
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				// The subscription has been dropped by broadcast
+				encoder.Encode(DaemonResponse{Error: "subscription dropped, client does not keep up with the updates"})
+				return
+			}
+			if err := encoder.Encode(update); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Subscribe returns a channel, which receives all transition events and the jobs after every refresh
+func (d *Daemon) Subscribe() chan DaemonResponse {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	updates := make(chan DaemonResponse, subscriberBuffer)
+	d.subscribers[updates] = true
+	return updates
+}
+
+func (d *Daemon) Unsubscribe(updates chan DaemonResponse) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.subscribers[updates]; ok {
+		delete(d.subscribers, updates)
+		close(updates)
+	}
+}
+
+// Send the update to all subscribers. Subscribers that don't keep up are dropped and receive an error. Requires the mutex to be locked
+func (d *Daemon) broadcast(update DaemonResponse) {
+	for updates := range d.subscribers {
+		select {
+		case updates <- update:
+		default:
+			delete(d.subscribers, updates)
+			close(updates)
+		}
+	}
+}
+
+// Copy of the current jobs. Requires the mutex to be locked
+func (d *Daemon) snapshot() []gopenqa.Job {
+	jobs := make([]gopenqa.Job, len(d.jobs))
+	copy(jobs, d.jobs)
+	return jobs
+}
+
+// Jobs returns a copy of the current jobs
+func (d *Daemon) Jobs() []gopenqa.Job {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.snapshot()
+}
+
+// Remotes returns a copy of the monitored remotes
+func (d *Daemon) Remotes() []Remote {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	remotes := make([]Remote, 0)
+	for _, remote := range d.remotes {
+		remote.Jobs = append([]int64{}, remote.Jobs...)
+		if len(remote.Params) > 0 {
+			remote.Params = remote.QueryParams()
+		}
+		remotes = append(remotes, remote)
+	}
+	return remotes
+}
+
+// Refresh triggers a refresh, unless one is already pending
+func (d *Daemon) Refresh() {
+	select {
+	case d.refresh <- 1:
+	default:
+	}
+}
+
+// Handle executes a single request
+func (d *Daemon) Handle(req DaemonRequest) DaemonResponse {
+	remote := req.Remote
+	if remote == "" {
+		remote = config.DefaultRemote
+	}
+	switch req.Command {
+	case "list":
+		return DaemonResponse{Jobs: d.Jobs()}
+	case "refresh":
+		d.Refresh()
+	case "add":
+		if remote == "" {
+			return DaemonResponse{Error: "missing remote"}
+		}
+		if len(req.Jobs) == 0 && len(req.Params) == 0 {
+			return DaemonResponse{Error: "missing jobs"}
+		}
+		d.mutex.Lock()
+		for _, id := range req.Jobs {
+			d.remotes = appendRemote(d.remotes, remote, id)
+			delete(d.dropped, jobKey{Remote: ensureHTTP(homogenizeRemote(remote)), ID: id})
+		}
+		if len(req.Params) > 0 {
+			d.remotes = appendQueryRemote(d.remotes, remote, req.Params)
+		}
+		d.generation++
+		d.mutex.Unlock()
+		d.Refresh()
+	case "remove":
+		if len(req.Jobs) == 0 {
+			return DaemonResponse{Error: "missing jobs"}
+		}
+		d.mutex.Lock()
+		for _, id := range req.Jobs {
+			d.remove(remote, id)
+		}
+		d.generation++
+		d.broadcast(DaemonResponse{Jobs: d.snapshot()})
+		d.mutex.Unlock()
+	default:
+		return DaemonResponse{Error: fmt.Sprintf("unknown command: %s", req.Command)}
+	}
+	return DaemonResponse{}
+}
+
+// Remove the given job from the remote, or from all remotes if remote is empty. Requires the mutex to be locked
+func (d *Daemon) remove(remote string, id int64) {
+	matches := func(uri string) bool {
+		return remote == "" || ensureHTTP(homogenizeRemote(uri)) == ensureHTTP(homogenizeRemote(remote))
+	}
+	monitored := make([]Remote, 0)
+	for _, r := range d.remotes {
+		if matches(r.URI) {
+			n := len(r.Jobs)
+			r.Jobs = filterIDs(r.Jobs, func(i int64) bool { return i != id })
+			d.dropped[jobKey{Remote: ensureHTTP(r.URI), ID: id}] = true
+			// Remotes without remaining jobs are removed, as they would otherwise fall back to the overview
+			if n > 0 && len(r.Jobs) == 0 && len(r.Params) == 0 {
+				continue
+			}
+		}
+		monitored = append(monitored, r)
+	}
+	d.remotes = monitored
+	d.jobs = filterJobs(d.jobs, func(job gopenqa.Job) bool {
+		if job.ID == id && matches(job.Remote) {
+			d.dropped[jobKey{Remote: job.Remote, ID: job.ID}] = true
+			return false
+		}
+		return true
+	})
+}
+
+// Fetch all jobs, record and broadcast the transitions and notify about changed jobs
+func (d *Daemon) fetch() error {
+	d.mutex.Lock()
+	generation := d.generation
+	d.mutex.Unlock()
+	remotes := d.Remotes()
+
+	exists := make(map[jobKey]bool, 0)
+	notifyJobs := make([]gopenqa.Job, 0)
+	remotes, err := FetchJobs(remotes, func(id int64, job gopenqa.Job) {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if d.dropped[jobKey{Remote: job.Remote, ID: id}] || d.dropped[jobKey{Remote: job.Remote, ID: job.ID}] {
+			return
+		}
+		exists[jobKey{Remote: job.Remote, ID: job.ID}] = true
+		old, found := gopenqa.Job{}, false
+		for i, j := range d.jobs {
+			// Compare to given id as this is the original id (not the ID of a possible cloned job)
+			if j.ID == id && j.Remote == job.Remote {
+				old, found = j, true
+				d.jobs[i] = job
+				break
+			}
+		}
+		if !found {
+			d.jobs = append(d.jobs, job)
+		}
+		if IsTransition(old, job) {
+			event := CreateEvent(old, job, id, "poll", time.Now())
+			if eventLog != nil {
+				if err := eventLog.Write(event); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing event log: %s\n", err)
+				}
+			}
+			// Only the event, the jobs are sent once after the refresh
+			d.broadcast(DaemonResponse{Event: &event})
+		}
+		if found && old.JobState() != job.JobState() {
+			notifyJobs = append(notifyJobs, job)
+		}
+	})
+
+	d.mutex.Lock()
+	// Keep changes of the remotes during the refresh
+	if d.generation == generation {
+		d.remotes = remotes
+	}
+	// Remove jobs which are not present anymore - (e.g. old children). Jobs of remotes that could not be fetched are kept as stale
+	errs := AsFetchErrors(err)
+	SetRemoteErrors(errs)
+	d.jobs = uniqueJobs(filterJobs(d.jobs, func(job gopenqa.Job) bool {
+		return exists[jobKey{Remote: job.Remote, ID: job.ID}] || errs[job.Remote] != nil
+	}))
+	jobs := d.snapshot()
+	d.broadcast(DaemonResponse{Jobs: jobs})
+	d.mutex.Unlock()
+
+	UpdateJobMetrics(metrics, jobs)
+	refreshed(remotes, err)
+	PruneCaches(jobs)
+	if len(notifyJobs) > 0 {
+		NotifyJobsChanged(notifyJobs)
+	}
+	if alerts.Enabled() {
+		checkAlerts(jobs)
+	}
+	return err
+}
+
+// Run the monitoring loop of the daemon. Never returns
+func (d *Daemon) Run() {
+	for {
+		if err := d.fetch(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching jobs: %s\n", err)
+		}
+		interval := minimumInterval(d.Remotes(), config.Continuous)
+		select {
+		case <-d.refresh:
+		case <-time.After(time.Duration(interval) * time.Second):
+		}
+	}
+}
+
+// Run openqa-mon as daemon on the given socket
+func runDaemon(remotes []Remote, socket string) {
+	if config.Continuous <= 0 {
+		config.Continuous = 60
+	}
+	config.Bell = false // There is no terminal to ring the bell
+	daemon := CreateDaemon(remotes)
+	listener, err := daemon.Listen(socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating control socket: %s\n", err)
+		os.Exit(1)
+	}
+	// Remove the socket on termination
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+		listener.Close()
+		os.Exit(0)
+	}()
+	fmt.Fprintf(os.Stderr, "openqa-mon v%s daemon listening on %s\n", internal.VERSION, socket)
+	daemon.Run()
+}
+
+// DaemonCall sends a single request to the daemon on the given socket and returns its response
+func DaemonCall(socket string, req DaemonRequest) (DaemonResponse, error) {
+	var resp DaemonResponse
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("%s", resp.Error)
+	}
+	return resp, nil
+}
+
+// Attach to the daemon on the given socket and display its jobs in the TUI. The given remotes are added to the daemon
+func attach(remotes []Remote, socket string) {
+	for _, remote := range remotes {
+		if len(remote.Jobs) == 0 && len(remote.Params) == 0 {
+			continue
+		}
+		if _, err := DaemonCall(socket, DaemonRequest{Command: "add", Remote: remote.URI, Jobs: remote.Jobs, Params: remote.Params}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding jobs to daemon: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to daemon: %s\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(DaemonRequest{Command: "subscribe"}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error subscribing to daemon: %s\n", err)
+		os.Exit(1)
+	}
+
+	tui = CreateTUI()
+	tui.EnterAltScreen()
+	tui.Clear()
+	tui.remotes = socket
+	tui.SetHeader(fmt.Sprintf("openqa-mon v%s - Attached to %s", internal.VERSION, socket))
+	tui.Model.HideStates = config.HideStates
+	defer tui.LeaveAltScreen()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+		tui.LeaveAltScreen()
+		os.Exit(1)
+	}()
+
+	// Send a request to the daemon and show errors in the status line
+	call := func(req DaemonRequest) {
+		if _, err := DaemonCall(socket, req); err != nil {
+			tui.SetStatus(fmt.Sprintf("Daemon error: %s", err))
+		}
+	}
+	p := make([]byte, 3) // History, needed for special keys
+	tui.Keypress = func(b byte) {
+		p[2], p[1], p[0] = p[1], p[0], b
+		if p[2] == 27 && p[1] == 91 {
+			tui.NavigationKey(p[0])
+		} else if tui.DoShowDetails() && b != 27 && b != 91 {
+			// Any key returns from the job details
+			tui.SetShowDetails(false)
+		} else {
+			switch b {
+			case 'q':
+				tui.LeaveAltScreen()
+				os.Exit(0)
+			case 'j':
+				tui.CursorDown()
+			case 'k':
+				tui.CursorUp()
+			case 'i', '\n', '\r':
+				if _, ok := tui.SelectedJob(); ok {
+					tui.SetShowDetails(true)
+				}
+			case 'o':
+				if job, ok := tui.SelectedJob(); ok {
+					if err := openBrowser(job.Link); err != nil {
+						tui.SetStatus(fmt.Sprintf("error: %s", err))
+					}
+				}
+			case 'x':
+				if job, ok := tui.SelectedJob(); ok {
+					go call(DaemonRequest{Command: "remove", Remote: job.Remote, Jobs: []int64{job.ID}})
+					tui.SetStatus(fmt.Sprintf("Job %d removed from watch list", job.ID))
+				}
+			case 'r':
+				go call(DaemonRequest{Command: "refresh"})
+				tui.SetStatus("Refreshing ... ")
+			case '?':
+				tui.SetShowHelp(!tui.DoShowHelp())
+			case 'h':
+				tui.SetHideStates(!tui.DoHideStates())
+			}
+		}
+		tui.Update()
+	}
+	tui.Start()
+	tui.SetStatus("Attached to daemon")
+	tui.Update()
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var update DaemonResponse
+		if err := decoder.Decode(&update); err != nil {
+			tui.LeaveAltScreen()
+			fmt.Fprintf(os.Stderr, "Connection to daemon lost: %s\n", err)
+			os.Exit(1)
+		}
+		if update.Error != "" {
+			tui.LeaveAltScreen()
+			fmt.Fprintf(os.Stderr, "Daemon error: %s\n", update.Error)
+			os.Exit(1)
+		}
+		if event := update.Event; event != nil {
+			// Apply the transition until the jobs are sent after the refresh
+			tui.Model.Update(event.ID, event.Remote, func(job *gopenqa.Job) {
+				job.State, job.Result = event.NewState, event.NewResult
+			})
+			tui.SetStatus(fmt.Sprintf("Job %d - %s %s", event.ID, event.NewState, event.NewResult))
+		} else {
+			tui.Model.SetJobs(update.Jobs)
+		}
+		tui.Update()
+	}
+}
@@ -0,0 +1,76 @@
+/* Persistent log of observed job state transitions */
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// Event is a single observed state or result transition of a job, as written to the event log
+type Event struct {
+	Timestamp  string `json:"timestamp"`             // Time of the observation (RFC 3339)
+	Remote     string `json:"remote"`                // openQA instance the job belongs to
+	ID         int64  `json:"id"`                    // Job ID
+	OriginalID int64  `json:"original_id"`           // ID of the requested job
+	PreviousID int64  `json:"previous_id,omitempty"` // ID of the previously observed job, if the job has been replaced by its clone
+	CloneID    int64  `json:"clone_id,omitempty"`    // ID of the clone of this job, if cloned
+	OldState   string `json:"old_state"`             // Previous job state, empty for the first observation
+	OldResult  string `json:"old_result"`            // Previous job result, empty for the first observation
+	NewState   string `json:"new_state"`
+	NewResult  string `json:"new_result"`
+	Source     string `json:"source"` // "poll", "reconcile", "rabbitmq" or "restart"
+}
+
+// EventLog appends every event as json line to a file
+type EventLog struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// OpenEventLog opens the given event log file for appending. The file is created if it doesn't exist
+func OpenEventLog(filename string) (*EventLog, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLog{file: file}, nil
+}
+
+// CreateEvent creates the transition event from the old to the new job. old is the empty job for the first observation. id is the originally requested job ID
+func CreateEvent(old gopenqa.Job, job gopenqa.Job, id int64, source string, now time.Time) Event {
+	event := Event{Timestamp: now.Format(time.RFC3339), Remote: job.Remote, ID: job.ID, OriginalID: id, CloneID: job.CloneID, Source: source}
+	event.OldState, event.OldResult = old.State, old.Result
+	event.NewState, event.NewResult = job.State, job.Result
+	if old.ID != 0 && old.ID != job.ID {
+		event.PreviousID = old.ID
+	}
+	return event
+}
+
+// IsTransition returns true if the new job differs from the old job in its ID, state or result
+func IsTransition(old gopenqa.Job, job gopenqa.Job) bool {
+	return old.ID != job.ID || old.State != job.State || old.Result != job.Result
+}
+
+// Write appends the given event to the log
+func (log *EventLog) Write(event Event) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	_, err = log.file.Write(append(buf, '\n'))
+	return err
+}
+
+// Close closes the event log file
+func (log *EventLog) Close() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return log.file.Close()
+}
@@ -0,0 +1,99 @@
+/* Exit code policy when all jobs are done (--exit and --wait) */
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// Exit code, if the jobs are not done within the timeout. Same as timeout(1)
+const EXIT_TIMEOUT = 124
+
+// Results that count as success, if not configured otherwise
+var defaultAcceptedResults = []string{"passed", "softfailed"}
+
+// ExitPolicy decides which jobs count as failed and the resulting exit code
+type ExitPolicy struct {
+	Accepted   []string // Results that count as success. Empty for the default results
+	Ignored    []string // Results that count neither as success nor as failure. "cancelled" matches all cancelled jobs
+	Failed     int      // Exit code if jobs failed
+	Incomplete int      // Exit code if all failed jobs are incomplete, e.g. because of infrastructure issues
+	Timeout    int      // Exit code if the jobs are not done in time
+}
+
+// CreateExitPolicy creates the default policy: Only passed and softfailed jobs count as success
+func CreateExitPolicy() ExitPolicy {
+	return ExitPolicy{Failed: 1, Incomplete: 1, Timeout: EXIT_TIMEOUT}
+}
+
+// Parse a return code, which must be between 0 and 255
+func parseExitCode(value string) (int, error) {
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 0 || code > 255 {
+		return 0, fmt.Errorf("invalid return code: %s", value)
+	}
+	return code, nil
+}
+
+// Returns true if the given job is cancelled
+func isCancelled(job gopenqa.Job) bool {
+	return job.State == "cancelled" || job.Result == "user_cancelled" || job.Result == "obsoleted"
+}
+
+// IsIgnored returns true if the given job counts neither as success nor as failure
+func (policy *ExitPolicy) IsIgnored(job gopenqa.Job) bool {
+	for _, result := range policy.Ignored {
+		if job.Result == result || (result == "cancelled" && isCancelled(job)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFailed returns true if the given job is completed and counts as failed. This includes incomplete and cancelled jobs, unless they are ignored
+func (policy *ExitPolicy) IsFailed(job gopenqa.Job) bool {
+	// We only consider completed jobs
+	if job.State != "done" && job.State != "cancelled" {
+		return false
+	}
+	if policy.IsIgnored(job) {
+		return false
+	}
+	accepted := policy.Accepted
+	if len(accepted) == 0 {
+		accepted = defaultAcceptedResults
+	}
+	for _, result := range accepted {
+		if job.State == "done" && job.Result == result {
+			return false
+		}
+	}
+	return true
+}
+
+// FailedJobs returns the completed jobs that count as failed
+func (policy *ExitPolicy) FailedJobs(jobs []gopenqa.Job) []gopenqa.Job {
+	failed := make([]gopenqa.Job, 0)
+	for _, job := range jobs {
+		if policy.IsFailed(job) {
+			failed = append(failed, job)
+		}
+	}
+	return failed
+}
+
+// ExitCode returns the exit code for the given completed jobs
+func (policy *ExitPolicy) ExitCode(jobs []gopenqa.Job) int {
+	failed := policy.FailedJobs(jobs)
+	if len(failed) == 0 {
+		return 0
+	}
+	for _, job := range failed {
+		if job.Result != "incomplete" {
+			return policy.Failed
+		}
+	}
+	return policy.Incomplete
+}
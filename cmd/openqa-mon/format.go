@@ -0,0 +1,137 @@
+/* User-defined output templates for job lines */
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// JobFormat renders job lines from a user-defined text/template.
+// The template is executed on the job (gopenqa.Job), e.g. "{{pad 8 .ID}} {{color .}}{{.JobState}}{{reset}} {{setting . \"BUILD\"}}"
+type JobFormat struct {
+	colored  *template.Template // Template with enabled color functions
+	plain    *template.Template // Template with color functions that return empty strings
+	settings bool               // Template looks up job settings, which need to be fetched beforehand
+}
+
+// Named colors available in templates
+var templateColors = map[string]string{
+	"red":          ANSI_RED,
+	"green":        ANSI_GREEN,
+	"yellow":       ANSI_YELLOW,
+	"brightyellow": ANSI_BRIGHTYELLOW,
+	"blue":         ANSI_BLUE,
+	"magenta":      ANSI_MAGENTA,
+	"cyan":         ANSI_CYAN,
+	"white":        ANSI_WHITE,
+	"reset":        ANSI_RESET,
+}
+
+// Convert an arbitrary template value to a string
+func templateString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func templateFuncs(useColors bool) template.FuncMap {
+	return template.FuncMap{
+		// color returns the color of a job state when called with a job, or the given named color
+		"color": func(v interface{}) (string, error) {
+			if !useColors {
+				return "", nil
+			}
+			switch value := v.(type) {
+			case *gopenqa.Job:
+				return jobColor(*value), nil
+			case gopenqa.Job:
+				return jobColor(value), nil
+			}
+			name := strings.ToLower(templateString(v))
+			if color, ok := templateColors[name]; ok {
+				return color, nil
+			}
+			return "", fmt.Errorf("unknown color: %s", name)
+		},
+		"reset": func() string {
+			if !useColors {
+				return ""
+			}
+			return ANSI_RESET
+		},
+		// Left-align the given value and pad it with spaces to n characters
+		"pad": func(n int, v interface{}) string {
+			s := templateString(v)
+			return s + strings.Repeat(" ", max(0, n-utf8.RuneCountInString(s)))
+		},
+		// Right-align the given value and pad it with spaces to n characters
+		"lpad": func(n int, v interface{}) string {
+			s := templateString(v)
+			return strings.Repeat(" ", max(0, n-utf8.RuneCountInString(s))) + s
+		},
+		// Truncate the given value to at most n characters
+		"trunc": func(n int, v interface{}) string {
+			s := templateString(v)
+			if runes := []rune(s); n >= 0 && len(runes) > n {
+				return string(runes[:n])
+			}
+			return s
+		},
+		// Lookup a job setting, e.g. {{setting . "BUILD"}}. Only cached settings are shown, as the line is rendered without any request
+		"setting": func(job *gopenqa.Job, name string) string {
+			value, _ := CachedJobSetting(*job, name)
+			return value
+		},
+		// Progress of a running job, e.g. "[bootloader 12/40]". Empty for all other jobs
+		"progress": func(job *gopenqa.Job) string {
+			if progress, ok := CachedJobProgress(*job); ok {
+				return progress.String()
+			}
+			return ""
+		},
+		// Time in the current state and estimated remaining time, e.g. "running 1h02m, ETA 35m". Empty if unknown
+		"timing": func(job *gopenqa.Job) string {
+			return JobTiming(*job, time.Now())
+		},
+	}
+}
+
+// ParseJobFormat parses the given user-defined template
+func ParseJobFormat(format string) (*JobFormat, error) {
+	var err error
+	var jf JobFormat
+	if jf.colored, err = template.New("format").Funcs(templateFuncs(true)).Parse(format); err != nil {
+		return nil, err
+	}
+	if jf.plain, err = template.New("format").Funcs(templateFuncs(false)).Parse(format); err != nil {
+		return nil, err
+	}
+	// A false positive (e.g. "setting" in a text) only costs the prefetching of the settings
+	jf.settings = strings.Contains(format, "setting")
+	return &jf, nil
+}
+
+// UsesSettings returns true if the template looks up job settings. The settings are prefetched by FetchJobDetails
+func (jf *JobFormat) UsesSettings() bool {
+	return jf.settings
+}
+
+// Format renders the line for the given job
+func (jf *JobFormat) Format(job gopenqa.Job, useColors bool) (string, error) {
+	tmpl := jf.plain
+	if useColors {
+		tmpl = jf.colored
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, &job); err != nil {
+		return "", err
+	}
+	// A job is always a single line
+	return strings.ReplaceAll(buf.String(), "\n", " "), nil
+}
@@ -0,0 +1,110 @@
+/* JUnit XML reports for openqa-mon */
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Job duration in seconds, determined from the start and finish timestamps. Returns 0 if the duration cannot be determined
+func jobDuration(job gopenqa.Job) float64 {
+	tstarted, err := parseTimestamp(job.Tstarted)
+	if err != nil {
+		return 0
+	}
+	tfinished, err := parseTimestamp(job.Tfinished)
+	if err != nil {
+		return 0
+	}
+	if tfinished.Before(tstarted) {
+		return 0
+	}
+	return tfinished.Sub(tstarted).Seconds()
+}
+
+// CreateJUnitReport assembles the JUnit XML report for the given jobs. Every job is a testcase, jobs are grouped by their remote into testsuites.
+func CreateJUnitReport(jobs []gopenqa.Job) ([]byte, error) {
+	failed := make(map[int64]bool, 0)
+	for _, job := range getFailedJobs(jobs) {
+		failed[job.ID] = true
+	}
+
+	report := junitTestSuites{Name: "openqa-mon"}
+	timestamp := time.Now().Format("2006-01-02T15:04:05")
+	for _, job := range jobs {
+		// Search for the testsuite of this remote, create it if not yet present
+		remote := getHostname(job.Remote)
+		i := 0
+		for i < len(report.Suites) && report.Suites[i].Name != remote {
+			i++
+		}
+		if i == len(report.Suites) {
+			report.Suites = append(report.Suites, junitTestSuite{Name: remote, Timestamp: timestamp})
+		}
+		suite := &report.Suites[i]
+
+		testcase := junitTestCase{Name: fmt.Sprintf("%s@%s", job.Test, job.Settings.Machine), Classname: job.Name, Time: jobDuration(job)}
+		testcase.SystemOut = fmt.Sprintf("Job %d: %s\n%s", job.ID, job.JobState(), job.Link)
+		if failed[job.ID] {
+			testcase.Failure = &junitFailure{Message: fmt.Sprintf("job %d %s", job.ID, job.JobState()), Type: job.JobState(), Text: job.Link}
+			suite.Failures++
+			report.Failures++
+		}
+		suite.Cases = append(suite.Cases, testcase)
+		suite.Tests++
+		suite.Time += testcase.Time
+		report.Tests++
+		report.Time += testcase.Time
+	}
+
+	buf, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return buf, err
+	}
+	return append([]byte(xml.Header), buf...), nil
+}
+
+// WriteJUnitReport writes the JUnit XML report for the given jobs to filename
+func WriteJUnitReport(filename string, jobs []gopenqa.Job) error {
+	buf, err := CreateJUnitReport(jobs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf, 0644)
+}
@@ -0,0 +1,70 @@
+/* Prometheus metrics of the monitored jobs */
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+	"github.com/os-autoinst/openqa-mon/internal"
+)
+
+var metrics = CreateMonitorMetrics()
+
+// CreateMonitorMetrics creates the metrics registry with all metrics of openqa-mon
+func CreateMonitorMetrics() *internal.Metrics {
+	metrics := internal.CreateMetrics()
+	metrics.Register("openqa_mon_jobs", "gauge", "Number of monitored jobs by remote, state and result")
+	metrics.Register("openqa_mon_last_refresh_timestamp_seconds", "gauge", "Unix timestamp of the last successful refresh")
+	metrics.Register("openqa_mon_fetch_errors_total", "counter", "Number of failed job refreshes by remote")
+	metrics.Register("openqa_mon_rabbitmq_reconnects_total", "counter", "Number of RabbitMQ reconnects by remote")
+	return metrics
+}
+
+// UpdateJobMetrics recomputes the job metrics from the given jobs
+func UpdateJobMetrics(metrics *internal.Metrics, jobs []gopenqa.Job) {
+	type metricKey struct{ Remote, State, Result string }
+	counts := make(map[metricKey]int, 0)
+	for _, job := range jobs {
+		counts[metricKey{Remote: job.Remote, State: job.State, Result: job.Result}]++
+	}
+	metrics.Reset("openqa_mon_jobs")
+	for key, count := range counts {
+		metrics.Set("openqa_mon_jobs", float64(count), "remote", key.Remote, "state", key.State, "result", key.Result)
+	}
+}
+
+// Record the outcome of a job refresh of the given remotes
+func refreshed(remotes []Remote, err error) {
+	errs := AsFetchErrors(err)
+	for _, remote := range remotes {
+		uri := ensureHTTP(homogenizeRemote(remote.URI))
+		if errs[uri] != nil {
+			metrics.Add("openqa_mon_fetch_errors_total", 1, "remote", uri)
+		} else {
+			metrics.Add("openqa_mon_fetch_errors_total", 0, "remote", uri)
+		}
+	}
+	if err == nil {
+		metrics.Set("openqa_mon_last_refresh_timestamp_seconds", float64(time.Now().Unix()))
+	}
+}
+
+// Serve the metrics in the background, if enabled. The address is bound immediately, so that errors are reported before monitoring starts
+func serveMetrics() {
+	if config.MetricsListen == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", config.MetricsListen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving metrics: %s\n", err)
+		os.Exit(1)
+	}
+	go func() {
+		if err := metrics.Serve(listener); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving metrics: %s\n", err)
+		}
+	}()
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
@@ -20,11 +21,44 @@ import (
 
 var config Config
 var tui *TUI
+var jobFormat *JobFormat                          // User-defined job format, if set
+var alerts = CreateAlertMonitor()                 // Alert rules for stuck jobs
+var notifiers internal.Notifiers                  // Notification backends
+var notificationRules *internal.NotificationRules // Rules which jobs to notify about
+var aggregator *internal.Aggregator               // Notification batching and rate limiting
+var eventLog *EventLog                            // Log of job state transitions, if enabled
 
 // Remote instance
 type Remote struct {
-	URI  string
-	Jobs []int64
+	URI    string
+	Jobs   []int64
+	Params map[string]string // Overview query parameters (e.g. build, distri). If set, the jobs are resolved on every refresh. Values are query-escaped, repeated values are comma-separated
+}
+
+// QueryParams returns a copy of the overview query parameters of this remote
+func (remote *Remote) QueryParams() map[string]string {
+	params := gopenqa.EmptyParams()
+	for k, v := range remote.Params {
+		params[k] = v
+	}
+	return params
+}
+
+// AddParam adds an overview query parameter. Multiple values for the same parameter are combined
+func (remote *Remote) AddParam(name, value string) {
+	remote.addQueryParam(url.QueryEscape(name), url.QueryEscape(value))
+}
+
+// Add an already query-escaped overview query parameter
+func (remote *Remote) addQueryParam(name, value string) {
+	if remote.Params == nil {
+		remote.Params = make(map[string]string, 0)
+	}
+	if existing, ok := remote.Params[name]; ok && existing != "" {
+		remote.Params[name] = existing + "," + value
+	} else {
+		remote.Params[name] = value
+	}
 }
 
 var remotes []Remote
@@ -33,6 +67,8 @@ func printHelp() {
 	fmt.Printf("Usage: %s [OPTIONS] REMOTE [JOBS]\n", os.Args[0])
 	fmt.Println("  REMOTE can be the directlink to a test (e.g. https://openqa.opensuse.org/t123)")
 	fmt.Println("  or a job range (e.g. https://openqa.opensuse.org/t123..125 or https://openqa.opensuse.org/t123+2)")
+	fmt.Println("  or a test overview or job group link (e.g. https://openqa.opensuse.org/tests/overview?build=20250212&distri=opensuse")
+	fmt.Println("  or https://openqa.opensuse.org/group_overview/1)")
 	fmt.Println("")
 	fmt.Println("OPTIONS")
 	fmt.Println("")
@@ -43,7 +79,24 @@ func printHelp() {
 	fmt.Println("                                   or a job range (1335..1339 or 1335+4)")
 	fmt.Println("  -c,--continuous SECONDS          Continuously display stats, use rabbitmq if available otherwise status pulling")
 	fmt.Println("  -e,--exit                        Exit openqa-mon when all jobs are done (only in continuous mode)")
-	fmt.Println("                                   Return code is 0 if all jobs are passed or softfailing, 1 otherwise.")
+	fmt.Println("                                   Return code is 0 if all jobs are passed or softfailed, 1 otherwise.")
+	fmt.Println("  --accept-results RESULTS         Results that count as success with --exit and --wait (default: 'passed,softfailed')")
+	fmt.Println("  --ignore-results RESULTS         Results that count neither as success nor failure (e.g. 'cancelled,skipped,parallel_failed')")
+	fmt.Println("  --exit-failed CODE               Return code if jobs failed (default: 1)")
+	fmt.Println("  --exit-incomplete CODE           Return code if all failed jobs are incomplete (default: 1)")
+	fmt.Println("  --exit-timeout CODE              Return code if the jobs are not done within the --timeout (default: 124)")
+	fmt.Println("  --wait                           Wait until all jobs are done and print only their state transitions, without TUI")
+	fmt.Println("                                   Return code is the same as with --exit. Use '--output ndjson' for json lines")
+	fmt.Println("  --timeout DURATION               Maximum time to wait with --wait (e.g. 3600 or 2h)")
+	fmt.Println("  --auto-restart N                 Restart incomplete jobs up to N times and follow their clones (requires API credentials)")
+	fmt.Println("  --auto-restart-failed            Also restart failed jobs with --auto-restart")
+	fmt.Println("  --junit FILE                     Write a JUnit XML report of all jobs to FILE when exiting via --exit")
+	fmt.Println("  --event-log FILE                 Append every observed job state transition as json line to FILE")
+	fmt.Println("  --metrics-listen ADDR            Serve Prometheus metrics on ADDR (e.g. ':9100') at /metrics")
+	fmt.Println("")
+	fmt.Println("  --daemon                         Run as daemon, which monitors the jobs for all clients on the control socket")
+	fmt.Println("  --attach                         Display the jobs of a running daemon (given jobs are added to the daemon)")
+	fmt.Println("  --socket FILE                    Control socket of the daemon (default: $XDG_RUNTIME_DIR/openqa-mon.sock)")
 	fmt.Println("  -b,--bell                        Bell notification on job status changes")
 	fmt.Println("  -n,--notify                      Send desktop notifications on job status changes")
 	fmt.Println("  --no-bell                        Disable bell notification")
@@ -56,9 +109,21 @@ func printHelp() {
 	fmt.Println("  --rabbitmq                       Explicitly enable rabbitmq (experimental!!)")
 	fmt.Println("  --rabbit FILE                    Explicitly enable rabbitmq and load configurations from FILE")
 	fmt.Println("  --no-rabbit                      Don't use RabbitMQ, even if available")
+	fmt.Println("  --reconcile SECONDS              Poll interval to reconcile missed updates in RabbitMQ mode (default: 300, 0 = disabled)")
 	fmt.Println("  -p,--hierarchy                   Show job hierarchy (i.e. children jobs)")
 	fmt.Println("  --hide-state STATES              Hide jobs with that are in the given state (e.g. 'running,assigned')")
 	fmt.Println("")
+	fmt.Println("  --build BUILD                    Monitor all jobs of the given build on the last REMOTE")
+	fmt.Println("  --group GROUP                    Monitor all jobs of the given job group (id or name)")
+	fmt.Println("  --distri DISTRI                  Filter monitored jobs by distribution (e.g. 'opensuse')")
+	fmt.Println("  --distri-version VERSION         Filter monitored jobs by version (e.g. 'Tumbleweed')")
+	fmt.Println("  --flavor FLAVOR                  Filter monitored jobs by flavor (e.g. 'DVD')")
+	fmt.Println("  --arch ARCH                      Filter monitored jobs by architecture (e.g. 'x86_64')")
+	fmt.Println("  --filter NAME=VALUE              Add an arbitrary overview query parameter")
+	fmt.Println("                                   Filtered jobs are re-resolved on every refresh, so that new jobs show up")
+	fmt.Println("  --output FORMAT                  Output format in single-shot mode: 'text' (default), 'json' or 'ndjson'")
+	fmt.Println("  --format TEMPLATE                Go text/template for job lines (e.g. '{{pad 8 .ID}} {{color .}}{{.JobState}}{{reset}}')")
+	fmt.Println("")
 	fmt.Println("  --config FILE                    Read additional config file FILE")
 	fmt.Println("  -i, --input FILE                 Read jobs from FILE (additionally to program parameters)")
 	fmt.Println("")
@@ -93,6 +158,87 @@ func matchTestURL(url string) (bool, string, []int64) {
 	return false, "", jobs
 }
 
+/** Try to match the url to be a job overview url. On success, return the remote and the query-escaped query parameters
+ * Supported are the test overview (e.g. https://openqa.opensuse.org/tests/overview?distri=opensuse&build=20250212)
+ * and the job group overview (e.g. https://openqa.opensuse.org/group_overview/1)
+ */
+func matchOverviewURL(link string) (bool, string, map[string]string) {
+	params := make(map[string]string, 0)
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false, "", params
+	}
+	path := homogenizeRemote(u.Path)
+	if i := strings.LastIndex(path, "/tests/overview"); i >= 0 && i == len(path)-len("/tests/overview") {
+		for name, values := range u.Query() {
+			// openQA accepts repeated parameters, which gopenqa expects as comma-separated values. The values are escaped again, so that they keep their commas
+			escaped := make([]string, 0)
+			for _, value := range filterEmpty(values) {
+				escaped = append(escaped, url.QueryEscape(value))
+			}
+			if len(escaped) > 0 {
+				params[url.QueryEscape(name)] = strings.Join(escaped, ",")
+			}
+		}
+		path = path[:i]
+	} else if i := strings.LastIndex(path, "/group_overview/"); i >= 0 {
+		group := path[i+len("/group_overview/"):]
+		if _, err := strconv.Atoi(group); err != nil {
+			return false, "", params
+		}
+		params["groupid"] = group
+		path = path[:i]
+	} else {
+		return false, "", params
+	}
+	return true, fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, path), params
+}
+
+/** Append the remote given as link. Links to tests and overview pages are resolved into the monitored jobs or overview query */
+func appendRemoteURL(remotes []Remote, link string) []Remote {
+	link = removeFragment(link)
+	// Try to parse as job run (e.g. http://phoenix-openqa.qam.suse.de/t1241)
+	if match, url, jobIDs := matchTestURL(link); match {
+		for _, jobID := range jobIDs {
+			remotes = appendRemote(remotes, url, jobID)
+		}
+		return remotes
+	}
+	if match, url, params := matchOverviewURL(link); match {
+		return appendQueryRemote(remotes, url, params)
+	}
+	return appendRemote(remotes, link, 0)
+}
+
+/** Append the given remote with query-escaped overview query parameters */
+func appendQueryRemote(remotes []Remote, remote string, params map[string]string) []Remote {
+	remotes = appendRemote(remotes, remote, 0)
+	remote = homogenizeRemote(remote)
+	for i := range remotes {
+		if remotes[i].URI == remote {
+			for name, value := range params {
+				remotes[i].addQueryParam(name, value)
+			}
+		}
+	}
+	return remotes
+}
+
+// Add an overview query parameter to the last defined remote. Falls back to the default remote, if no remote is defined yet
+func addRemoteParam(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value for %s", name)
+	}
+	if len(remotes) == 0 {
+		if config.DefaultRemote == "" {
+			return fmt.Errorf("filters need to be defined after a remote instance")
+		}
+		remotes = appendRemote(remotes, config.DefaultRemote, 0)
+	}
+	remotes[len(remotes)-1].AddParam(name, value)
+	return nil
+}
+
 /* checks if all given jobs are done */
 func jobsDone(jobs []gopenqa.Job) bool {
 	for _, job := range jobs {
@@ -103,22 +249,9 @@ func jobsDone(jobs []gopenqa.Job) bool {
 	return true
 }
 
-/* checks if the set of jobs contains failed jobs. This includes incomplete jobs */
+/* checks if the set of jobs contains failed jobs according to the exit policy. This includes incomplete jobs */
 func getFailedJobs(jobs []gopenqa.Job) []gopenqa.Job {
-	ret := make([]gopenqa.Job, 0)
-	for _, job := range jobs {
-		// We only consider completed jobs
-		if job.State == "cancelled" {
-			ret = append(ret, job)
-		} else if job.State == "done" {
-			// Assume a job is failed, if it is not passed or softfailed
-			if job.Result != "passed" && job.Result != "softfail" {
-				ret = append(ret, job)
-			}
-			// Note: incomplete jobs also have state "done". They are also considered failed
-		}
-	}
-	return ret
+	return config.Exit.FailedJobs(jobs)
 }
 
 /** Append the given remote by adding a job id to the existing remote or creating a new one */
@@ -142,6 +275,19 @@ func appendRemote(remotes []Remote, remote string, jobID int64) []Remote {
 	return append(remotes, rem)
 }
 
+// Add the given job to the remote it belongs to. Remotes that display the overview remain unchanged
+func appendJobRemote(remotes []Remote, job gopenqa.Job) []Remote {
+	for i, remote := range remotes {
+		if ensureHTTP(homogenizeRemote(remote.URI)) == job.Remote {
+			if len(remote.Jobs) > 0 || len(remote.Params) > 0 {
+				remotes[i].Jobs = append(remotes[i].Jobs, job.ID)
+			}
+			return remotes
+		}
+	}
+	return appendRemote(remotes, job.Remote, job.ID)
+}
+
 // Expand short arguments
 func expandArguments(args []string) ([]string, error) {
 	ret := make([]string, 0)
@@ -206,43 +352,6 @@ func expandArguments(args []string) ([]string, error) {
 	return ret, nil
 }
 
-/** Try to update the job with the given status, if present. Returns the found job and true if the job was present */
-func updateJobStatus(status gopenqa.JobStatus, openqaURI string) (gopenqa.Job, bool) {
-	if len(tui.Model.jobs) == 0 {
-		return gopenqa.Job{ID: 0}, false
-	}
-	for i, j := range tui.Model.jobs {
-		if j.ID == status.ID && j.Remote == openqaURI {
-			tui.Model.jobs[i].State = "done"
-			tui.Model.jobs[i].Result = fmt.Sprintf("%s", status.Result)
-			return tui.Model.jobs[i], true
-		}
-	}
-	return gopenqa.Job{ID: 0}, false
-}
-
-/** Search for the given job and fetch it from the openQA instance. Returns the new job and a boolean indicating if the job has been found */
-func updateJob(job int64, openqaURI string) (gopenqa.Job, bool) {
-	jobs := tui.Model.jobs
-	if len(jobs) == 0 {
-		return gopenqa.Job{ID: 0}, false
-	}
-	for i, j := range jobs {
-		if j.ID == job && j.Remote == openqaURI {
-			instance := gopenqa.CreateInstance(ensureHTTP(openqaURI))
-			instance.SetUserAgent("openqa-mon")
-			instance.SetMaxRecursionDepth(100) // Certain jobs (e.g. verification runs) can have a lot of clones
-			if job, err := instance.GetJobFollow(job); err == nil {
-				jobs[i] = job
-				tui.Model.SetJobs(jobs)
-				return job, true
-			}
-			return jobs[i], true
-		}
-	}
-	return gopenqa.Job{ID: 0}, false
-}
-
 func assembleRabbitMQRemote(remote, username, password string) string {
 	// Extract protocol, if present
 	protocol := "amqps://"
@@ -311,100 +420,6 @@ func getHostname(uri string) string {
 	return hostname
 }
 
-// Register the given rabbitMQ instance for the tui
-func registerRabbitMQ(tui *TUI, openqaURI string, remote string, topics []string) (gopenqa.RabbitMQ, error) {
-	rmq, err := gopenqa.ConnectRabbitMQ(remote)
-	if err != nil {
-		return rmq, fmt.Errorf("RabbitMQ connection error: %s", err)
-	}
-
-	recvFunction := func(rmq *gopenqa.RabbitMQ) {
-		connectedFlag := make(chan int)
-		reconnects := 0
-
-		// Loop until closed
-		for !rmq.Closed() {
-			// Subscribe to all topics in their own goroutine.
-			// subscriptions notify us via the connectedFlag channel about error events.
-			for _, topic := range topics {
-				go func(topic string) {
-					sub, err := rmq.Subscribe(topic)
-					if err != nil {
-						tui.SetStatus(fmt.Sprintf("RabbitMQ subscribe error: %s", err))
-						connectedFlag <- 0 // Notify that something's off
-						return
-					}
-
-					for {
-						if status, err := sub.ReceiveJobStatus(); err != nil {
-							// Receive failed
-							tui.SetStatus(fmt.Sprintf("rabbitmq recv error: %s", err))
-							connectedFlag <- 0
-							return
-							// Ignore empty updates (status.ID == 0)
-						} else if status.ID != 0 {
-							if status.Type == "job.done" {
-								tui.SetStatus(fmt.Sprintf("Job %d - %s", status.ID, status.Result))
-								// Update job, if present
-								if job, found := updateJobStatus(status, openqaURI); found {
-									tui.Update()
-									if config.Notify {
-										jobs := make([]gopenqa.Job, 0)
-										jobs = append(jobs, job)
-										NotifyJobsChanged(jobs)
-									}
-								}
-							} else if status.Type == "job.restarted" {
-								// Update the job that is being restarted
-
-								if job, found := updateJob(status.ID, openqaURI); found {
-									tui.Update()
-									if config.Notify {
-										jobs := make([]gopenqa.Job, 0)
-										jobs = append(jobs, job)
-										NotifyJobsChanged(jobs)
-									}
-								}
-							} else {
-								// Unknown job status
-								tui.SetStatus(fmt.Sprintf("job %d: %s", status.ID, status.Type))
-							}
-						}
-					}
-				}(topic)
-			}
-
-			// Wait for someone to notify us about a broken channel
-			if reconnects == 0 {
-				tui.SetStatus("RabbitMQ mode")
-			} else if reconnects == 1 {
-				tui.SetStatus("RabbitMQ mode (reconnected)")
-			} else {
-				tui.SetStatus(fmt.Sprintf("RabbitMQ mode (%dx reconnected)", reconnects))
-			}
-			<-connectedFlag
-			rmq.Close() // Close for everyone and wait a bit before reconnecting
-			reconnects++
-			tui.SetStatus(fmt.Sprintf("RabbitMQ reconnecting %d ...", reconnects))
-			time.Sleep(time.Duration(2) * time.Second)
-			// Consume remaining signals
-			consuming := true
-			for consuming {
-				select {
-				case <-connectedFlag:
-					consuming = true
-				default:
-					consuming = false
-				}
-			}
-			rmq.Reconnect()
-			tui.SetStatus(fmt.Sprintf("RabbitMQ reconnecting %d ...", reconnects))
-		}
-	}
-	go recvFunction(&rmq)
-	return rmq, nil
-}
-
 func readJobs(filename string) ([]Remote, error) {
 	remotes := make([]Remote, 0)
 
@@ -425,15 +440,7 @@ func readJobs(filename string) ([]Remote, error) {
 
 		// Only accept URLs here
 		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
-			// Try to parse as job run (e.g. http://phoenix-openqa.qam.suse.de/t1241)
-			match, url, jobIDs := matchTestURL(removeFragment(line))
-			if match {
-				for _, jobID := range jobIDs {
-					remotes = appendRemote(remotes, url, jobID)
-				}
-			} else {
-				remotes = appendRemote(remotes, line, 0)
-			}
+			remotes = appendRemoteURL(remotes, line)
 		} else {
 			return remotes, fmt.Errorf("invalid job link (line %d)", iLine)
 		}
@@ -453,6 +460,9 @@ func SetStatus() {
 	}
 	if config.Continuous > 0 {
 		status := fmt.Sprintf("(continuous monitoring) | %d seconds |", config.Continuous)
+		if config.Hybrid {
+			status = fmt.Sprintf("RabbitMQ mode | reconciling every %d seconds |", pollInterval())
+		}
 		if config.Bell || config.Notify {
 			status += " ("
 			if config.Bell {
@@ -549,6 +559,15 @@ func parseProgramArguments(cliargs []string) error {
 				config.RabbitMQFiles = append(config.RabbitMQFiles, args[i])
 			case "--no-rabbit":
 				config.RabbitMQ = false
+			case "--reconcile":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing reconciliation interval")
+				}
+				config.Reconcile, err = strconv.Atoi(args[i])
+				if err != nil || config.Reconcile < 0 {
+					return fmt.Errorf("invalid reconciliation interval")
+				}
 			case "--hierarchy":
 				config.Hierarchy = true
 			case "--config":
@@ -568,8 +587,129 @@ func parseProgramArguments(cliargs []string) error {
 				}
 				states := trimSplit(args[i], ",")
 				config.HideStates = append(config.HideStates, states...)
+			case "--output":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing output format")
+				}
+				switch args[i] {
+				case "text", "json", "ndjson":
+					config.Output = args[i]
+				default:
+					return fmt.Errorf("invalid output format: %s", args[i])
+				}
+			case "--format":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing format template")
+				}
+				config.Format = args[i]
+			case "--build", "--group", "--distri", "--distri-version", "--flavor", "--arch", "--filter":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing argument for %s", arg)
+				}
+				name, value := arg[2:], args[i]
+				switch arg {
+				case "--distri-version":
+					name = "version"
+				case "--group":
+					// openQA distinguishes between group ids and group names
+					if _, err := strconv.Atoi(value); err == nil {
+						name = "groupid"
+					}
+				case "--filter":
+					sep := strings.Index(value, "=")
+					if sep <= 0 {
+						return fmt.Errorf("invalid filter: %s", value)
+					}
+					name, value = value[:sep], value[sep+1:]
+				}
+				if err := addRemoteParam(name, value); err != nil {
+					return err
+				}
 			case "--quit", "--exit":
 				config.Quit = true
+			case "--junit":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing JUnit report file")
+				}
+				config.JUnitFile = args[i]
+			case "--event-log":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing event log file")
+				}
+				config.EventLogFile = args[i]
+			case "--accept-results":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing accepted results")
+				}
+				config.Exit.Accepted = filterEmpty(trimSplit(args[i], ","))
+			case "--ignore-results":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing ignored results")
+				}
+				config.Exit.Ignored = filterEmpty(trimSplit(args[i], ","))
+			case "--exit-failed", "--exit-incomplete", "--exit-timeout":
+				arg := args[i]
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing return code")
+				}
+				code, err := parseExitCode(args[i])
+				if err != nil {
+					return err
+				}
+				switch arg {
+				case "--exit-failed":
+					config.Exit.Failed = code
+				case "--exit-incomplete":
+					config.Exit.Incomplete = code
+				case "--exit-timeout":
+					config.Exit.Timeout = code
+				}
+			case "--auto-restart":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing number of restarts")
+				}
+				config.AutoRestart, err = strconv.Atoi(args[i])
+				if err != nil || config.AutoRestart < 0 {
+					return fmt.Errorf("invalid number of restarts: %s", args[i])
+				}
+			case "--auto-restart-failed":
+				config.AutoRestartFailed = true
+			case "--wait":
+				config.Wait = true
+			case "--timeout":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing timeout")
+				}
+				config.Timeout, err = parseTimeout(args[i])
+				if err != nil || config.Timeout < 0 {
+					return fmt.Errorf("invalid timeout: %s", args[i])
+				}
+			case "--daemon":
+				config.Daemon = true
+			case "--attach":
+				config.Attach = true
+			case "--socket":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing socket file")
+				}
+				config.Socket = args[i]
+			case "--metrics-listen":
+				i++
+				if i >= len(args) {
+					return fmt.Errorf("missing metrics listen address")
+				}
+				config.MetricsListen = args[i]
 			case "--input":
 				i++
 				if i >= len(args) {
@@ -579,11 +719,14 @@ func parseProgramArguments(cliargs []string) error {
 				if jobs, err := readJobs(args[i]); err != nil {
 					return fmt.Errorf("error reading jobs: %s", err)
 				} else {
-					// Append all found jobs
+					// Append all found jobs and queries
 					for _, remote := range jobs {
 						for _, job := range remote.Jobs {
 							remotes = appendRemote(remotes, remote.URI, job)
 						}
+						if len(remote.Params) > 0 {
+							remotes = appendQueryRemote(remotes, remote.URI, remote.Params)
+						}
 					}
 				}
 			default:
@@ -593,15 +736,7 @@ func parseProgramArguments(cliargs []string) error {
 			// No argument, so it's either a job id, a job id range or a remote URI.
 			// If it's a uri, skip the job id test
 			if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
-				// Try to parse as job run (e.g. http://phoenix-openqa.qam.suse.de/t1241)
-				match, url, jobIDs := matchTestURL(removeFragment(arg))
-				if match {
-					for _, jobID := range jobIDs {
-						remotes = appendRemote(remotes, url, jobID)
-					}
-				} else {
-					remotes = appendRemote(remotes, arg, 0)
-				}
+				remotes = appendRemoteURL(remotes, arg)
 			} else {
 				// If the argument is a number only, assume it's a job ID otherwise it's a host
 				jobIDs := parseJobIDs(removeFragment(arg))
@@ -653,6 +788,74 @@ func main() {
 		os.Exit(1)
 	}
 
+	if config.Format != "" {
+		if jobFormat, err = ParseJobFormat(config.Format); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid format template: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if notifiers, err = internal.CreateNotifiers(config.Notifiers); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid notification configuration: %s\n", err)
+		os.Exit(1)
+	}
+	if notificationRules, err = internal.CreateNotificationRules(config.NotificationRules); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid notification rules: %s\n", err)
+		os.Exit(1)
+	}
+	if config.EventLogFile != "" {
+		if eventLog, err = OpenEventLog(config.EventLogFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening event log: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	aggregator = internal.CreateAggregator("openqa-mon", time.Duration(config.NotifyWindow)*time.Second, config.NotifyMaxPerMinute, notify)
+	aggregator.Build = func(job gopenqa.Job) string {
+		// Called while the aggregator is locked, so only settings that have been fetched already are used
+		if build, ok := CachedJobSetting(job, "BUILD"); ok && build != "" {
+			return build
+		}
+		return internal.BuildFromName(job)
+	}
+
+	// The request pool bounds the number of concurrent requests, also to the same instance
+	requests = make(requestPool, max(1, config.Workers))
+	instances.SetParallel(true)
+	// Transient errors of idempotent requests are retried
+	internal.InstallRetryTransport(config.Retries, time.Duration(config.RetryDelay*float64(time.Second)))
+
+	// Alert rules for stuck jobs
+	alerts.Scheduled = time.Duration(config.AlertScheduled) * time.Minute
+	alerts.Running = config.AlertRunning
+	alerts.Uploading = time.Duration(config.AlertUploading) * time.Minute
+
+	// Automatic restarts follow the clones
+	if config.AutoRestart > 0 {
+		if !config.Follow {
+			fmt.Fprintf(os.Stderr, "--auto-restart cannot be used with --no-follow\n")
+			os.Exit(1)
+		}
+		restarter = CreateAutoRestarter(config.AutoRestart, config.AutoRestartFailed)
+		if err := instances.LoadCredentials(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading API credentials: %s\n", err)
+		}
+	}
+
+	// Daemon and thin client of the daemon
+	if config.Socket == "" {
+		config.Socket = DefaultSocket()
+	}
+	if config.Daemon || config.Attach {
+		for i := range remotes {
+			remotes[i].Jobs = unique(remotes[i].Jobs)
+		}
+		if config.Attach {
+			attach(remotes, config.Socket)
+			os.Exit(0)
+		}
+		serveMetrics()
+		runDaemon(remotes, config.Socket)
+	}
+
 	// No jobs and no remotes is considered wrong usage
 	if len(remotes) == 0 {
 		printHelp()
@@ -667,19 +870,30 @@ func main() {
 		})
 	}
 
+	// Wait for the jobs, no TUI
+	if config.Wait {
+		if config.Continuous <= 0 {
+			config.Continuous = 30
+		}
+		config.Continuous = minimumInterval(remotes, config.Continuous)
+		serveMetrics()
+		os.Exit(waitForJobs(remotes, os.Stdout))
+	}
+
 	// Single listing mode, no TUI
 	if config.Continuous <= 0 {
 		singleCall(remotes)
 		os.Exit(0)
 	}
 
-	// Refresh rates below 30 seconds are not allowed on public instances
-	if config.Continuous < 30 {
-		for _, remote := range remotes {
-			if strings.Contains(remote.URI, "://openqa.suse.de") || strings.Contains(remote.URI, "://openqa.opensuse.org") {
-				config.Continuous = 30
-				break
-			}
+	config.Continuous = minimumInterval(remotes, config.Continuous)
+
+	serveMetrics()
+
+	// API credentials are only required for restarting and cancelling jobs. Errors are printed before entering the alt screen, where they would be lost
+	if !restarter.Enabled() {
+		if err := instances.LoadCredentials(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading API credentials: %s\n", err)
 		}
 	}
 
@@ -699,126 +913,344 @@ func main() {
 	os.Exit(0)
 }
 
+// Seconds until the next refresh. In RabbitMQ mode, polling only reconciles missed updates and jobs that started, so it happens less often
+func pollInterval() int {
+	if config.Hybrid {
+		return max(config.Reconcile, config.Continuous)
+	}
+	return config.Continuous
+}
+
+// Refresh rates below 30 seconds are not allowed on public instances. Returns the allowed refresh interval for the given remotes
+func minimumInterval(remotes []Remote, interval int) int {
+	if interval < 30 {
+		for _, remote := range remotes {
+			if strings.Contains(remote.URI, "://openqa.suse.de") || strings.Contains(remote.URI, "://openqa.opensuse.org") {
+				return 30
+			}
+		}
+	}
+	return interval
+}
+
 /* Get all jobs from the given remotes
- * callback will be called for each received job
- * returns the (possibly modified) input remotes
+ * The remotes are fetched concurrently. callback will be called for each received job, in the order of the remotes
+ * returns the (possibly modified) input remotes and FetchErrors for the remotes that could not be fetched
  */
 func FetchJobs(remotes []Remote, callback func(int64, gopenqa.Job)) ([]Remote, error) {
+	type fetchedJob struct {
+		ID  int64
+		Job gopenqa.Job
+	}
+	fetched := make([][]fetchedJob, len(remotes))
+	errs := make([]error, len(remotes))
+	done := make([]chan bool, len(remotes))
+	for i := range remotes {
+		done[i] = make(chan bool)
+		go func(remote *Remote) {
+			defer close(done[i])
+			collect := func(id int64, job gopenqa.Job) {
+				fetched[i] = append(fetched[i], fetchedJob{ID: id, Job: job})
+			}
+			errs[i] = fetchRemote(remote, collect)
+		}(&remotes[i])
+	}
+
+	// Pass the jobs of every remote to the callback as soon as the remote and all remotes before are done
+	ret := make(FetchErrors, 0)
 	for i, remote := range remotes {
-		instance := gopenqa.CreateInstance(ensureHTTP(remote.URI))
-		instance.SetUserAgent("openqa-mon")
-		instance.SetMaxRecursionDepth(20) // Certain jobs (e.g. verification runs) can have a lot of clones
+		<-done[i]
+		for _, job := range fetched[i] {
+			callback(job.ID, job.Job)
+		}
+		if errs[i] != nil {
+			ret[ensureHTTP(homogenizeRemote(remote.URI))] = errs[i]
+		}
+	}
+	if len(ret) > 0 {
+		return remotes, ret
+	}
+	return remotes, nil
+}
+
+// Fetch the jobs of a single remote. Updates the job IDs of the remote when following jobs
+func fetchRemote(remote *Remote, callback func(int64, gopenqa.Job)) error {
+	instance := instances.Get(remote.URI)
+	if len(remote.Params) > 0 {
+		// Re-resolve the jobs on every call, so that newly scheduled jobs are picked up as well
+		var overview []gopenqa.Job
+		var err error
+		requests.Do(func() { overview, err = instance.GetOverview("", remote.QueryParams()) })
+		if err != nil {
+			return err
+		}
+		ids := unique(append(gopenqa.ExtractJobIDS(overview), remote.Jobs...))
+		if _, err := fetchJobIDs(instance, ids, callback); err != nil {
+			return err
+		}
+	} else if len(remote.Jobs) == 0 {
 		// If no jobs are defined, fetch overview
-		if len(remote.Jobs) == 0 {
-			overview, err := instance.GetOverview("", gopenqa.EmptyParams())
-			if err != nil {
-				return remotes, err
-			}
-			for _, job := range overview {
-				callback(job.ID, job)
-			}
-		} else {
-			// Fetch individual jobs
-			jobsModified := false // If remote.Jobs has been modified (e.g. id changes when detecting a restarted job)
-			jobs, err := instance.GetJobs(remote.Jobs)
+		var overview []gopenqa.Job
+		var err error
+		requests.Do(func() { overview, err = instance.GetOverview("", gopenqa.EmptyParams()) })
+		if err != nil {
+			return err
+		}
+		if fetchDetails {
+			requests.Parallel(len(overview), func(i int) { FetchJobDetails(overview[i]) })
+		}
+		for _, job := range overview {
+			callback(job.ID, job)
+		}
+	} else {
+		// Fetch individual jobs
+		jobsModified, err := fetchJobIDs(instance, remote.Jobs, callback)
+		if err != nil {
+			return err
+		}
+		if jobsModified {
+			// Ensure the job IDs are unique and sorted
+			jobs := unique(remote.Jobs)
+			sort.Slice(jobs, func(i, j int) bool {
+				return jobs[i] < jobs[j]
+			})
+			remote.Jobs = jobs
+		}
+	}
+	return nil
+}
+
+/* Fetch the given job IDs from the instance, follow them and fetch their children if enabled
+ * callback will be called for each received job, children after their parent
+ * The ids get replaced by the ID of their clones when following. Returns true, if ids have been modified
+ */
+func fetchJobIDs(instance *gopenqa.Instance, ids []int64, callback func(int64, gopenqa.Job)) (bool, error) {
+	jobsModified := false // If ids has been modified (e.g. id changes when detecting a restarted job)
+	// Fetch in chunks to keep the request URLs short for large builds
+	chunks := make([][]int64, 0)
+	for chunk := ids; len(chunk) > 0; {
+		n := min(100, len(chunk))
+		chunks = append(chunks, chunk[:n])
+		chunk = chunk[n:]
+	}
+	fetched := make([][]gopenqa.Job, len(chunks))
+	errs := make([]error, len(chunks))
+	requests.Parallel(len(chunks), func(i int) {
+		fetched[i], errs[i] = instance.GetJobs(chunks[i])
+	})
+	jobs := make([]gopenqa.Job, 0)
+	for i := range chunks {
+		if errs[i] != nil {
+			return jobsModified, errs[i]
+		}
+		jobs = append(jobs, fetched[i]...)
+	}
+
+	// Follow the jobs and fetch their children concurrently
+	type jobTree struct {
+		Job      gopenqa.Job
+		Followed bool          // Job has been replaced by its clone
+		Skip     bool          // Following failed
+		Children []gopenqa.Job // Children with prefix, if enabled
+		Err      error
+	}
+	trees := make([]jobTree, len(jobs))
+	requests.Parallel(len(jobs), func(i int) {
+		tree := &trees[i]
+		tree.Job = jobs[i]
+		if config.Follow && (tree.Job.IsCloned()) {
+			job, err := instance.GetJobFollow(tree.Job.ID)
 			if err != nil {
-				return remotes, err
+				// It's better to ignore a single failure than to suppress following jobs as well
+				tree.Skip = true
+				return
 			}
-			for i, job := range jobs {
-				if config.Follow && (job.IsCloned()) {
-					job, err = instance.GetJobFollow(job.ID)
-					if err != nil {
-						// It's better to ignore a single failure than to suppress following jobs as well
-						continue
-					}
-					remote.Jobs[i] = job.ID
-					jobsModified = true
+			tree.Job, tree.Followed = job, true
+		}
+		// The details are fetched within the request slot of the job
+		if fetchDetails {
+			FetchJobDetails(tree.Job)
+		}
+		if config.Hierarchy {
+			// Depending on the child type, add prefix
+			job := tree.Job
+			for _, kind := range []struct {
+				IDs    []int64
+				Prefix string
+			}{{job.Children.DirectlyChained, "  +"}, {job.Children.Chained, "  ."}, {job.Children.Parallel, "  +"}} {
+				children, err := job.FetchChildren(kind.IDs, true)
+				if err != nil {
+					tree.Err = err
+					return
 				}
-				callback(job.ID, job)
-
-				// Fetch children
-				if config.Hierarchy {
-					// Depending on the child type, add prefix
-					if children, err := job.FetchChildren(job.Children.DirectlyChained, true); err != nil {
-						return remotes, err
-					} else {
-						for _, job := range children {
-							job.Prefix = "  +"
-							callback(job.ID, job)
-						}
-					}
-					if children, err := job.FetchChildren(job.Children.Chained, true); err != nil {
-						return remotes, err
-					} else {
-						for _, job := range children {
-							job.Prefix = "  ."
-							callback(job.ID, job)
-						}
-					}
-					if children, err := job.FetchChildren(job.Children.Parallel, true); err != nil {
-						return remotes, err
-					} else {
-						for _, job := range children {
-							job.Prefix = "  +"
-							callback(job.ID, job)
-						}
+				for _, child := range children {
+					child.Prefix = kind.Prefix
+					if fetchDetails {
+						FetchJobDetails(child)
 					}
+					tree.Children = append(tree.Children, child)
 				}
 			}
-			if jobsModified {
-				// Ensure the job IDs are unique and sorted
-				jobs := unique(remote.Jobs)
-				sort.Slice(jobs, func(i, j int) bool {
-					return jobs[i] < jobs[j]
-				})
-				remotes[i].Jobs = jobs
+		}
+	})
+
+	for i, tree := range trees {
+		if tree.Skip {
+			continue
+		}
+		origID := jobs[i].ID // Keep the requested job ID, so that followed jobs can be matched to their origin
+		if tree.Followed {
+			if i < len(ids) {
+				ids[i] = tree.Job.ID
 			}
+			jobsModified = true
+		}
+		callback(origID, tree.Job)
+		if tree.Err != nil {
+			return jobsModified, tree.Err
+		}
+		for _, child := range tree.Children {
+			callback(child.ID, child)
 		}
 	}
-	return remotes, nil
+	return jobsModified, nil
 }
 
-// Fires a job notification, if notifications are enabled
+// Fires a job notification, if notifications are enabled. The notification rules decide about which jobs and via which backends to notify
 func NotifyJobsChanged(jobs []gopenqa.Job) {
+	// Group the jobs by the notification backends they are routed to
+	routes := make(map[string][]gopenqa.Job, 0)
+	for _, job := range jobs {
+		if ok, backends := notificationRules.Notify(job); ok {
+			route := strings.Join(backends, ",")
+			routes[route] = append(routes[route], job)
+		}
+	}
+	if len(routes) == 0 {
+		return
+	}
 	if config.Bell {
 		bell()
 	}
 	if config.Notify {
-		notification := ""
-		if len(jobs) == 1 {
-			j := jobs[0]
-			notification = fmt.Sprintf("[%s] - Job %d %s", j.JobState(), j.ID, j.Name)
-		} else {
+		// The aggregator coalesces the notifications into summaries and applies the rate limit
+		for route, jobs := range routes {
 			for _, j := range jobs {
-				notification += fmt.Sprintf("[%s] %s\n", j.JobState(), j.Name)
+				notification := fmt.Sprintf("[%s] - Job %d %s", j.JobState(), j.ID, j.Name)
+				aggregator.Add(internal.Notification{Title: "openqa-mon", Text: notification, Jobs: []gopenqa.Job{j}}, filterEmpty(strings.Split(route, ",")))
 			}
 		}
+		aggregator.Done()
+	}
+}
+
+// Record the transition from old to job in the event log, if enabled. id is the originally requested job ID
+func logTransition(old gopenqa.Job, job gopenqa.Job, id int64, source string) {
+	if eventLog == nil || !IsTransition(old, job) {
+		return
+	}
+	if err := eventLog.Write(CreateEvent(old, job, id, source, time.Now())); err != nil {
+		if tui == nil {
+			fmt.Fprintf(os.Stderr, "Error writing event log: %s\n", err)
+		} else {
+			tui.SetStatus(fmt.Sprintf("Error writing event log: %s", err))
+		}
+	}
+}
+
+// Fires a notification about stuck jobs, if notifications are enabled
+func NotifyAlerts(raised []Alert) {
+	if config.Bell {
+		bell()
+	}
+	if config.Notify {
+		notification := ""
+		for _, alert := range raised {
+			notification += fmt.Sprintf("[stuck] Job %d %s %s\n", alert.Job.ID, alert.Job.Name, alert.Reason)
+		}
 		notification = strings.TrimSpace(notification)
 
 		if notification != "" {
-			notifySend(notification)
+			stuck := make([]gopenqa.Job, 0)
+			for _, alert := range raised {
+				stuck = append(stuck, alert.Job)
+			}
+			notify(internal.Notification{Title: "openqa-mon: stuck jobs", Text: notification, Jobs: stuck}, nil)
 		}
 	}
 }
 
+// Check the given jobs for the alert rules and notify about newly stuck jobs
+func checkAlerts(jobs []gopenqa.Job) {
+	now := time.Now()
+	raised := make([]Alert, 0)
+	for _, job := range jobs {
+		// The usual duration is required for running jobs, also if they are updated via RabbitMQ
+		if alerts.Running > 0 && job.State == "running" {
+			GetScenarioDuration(job)
+		}
+		if reason, ok := alerts.Check(job, now); ok {
+			raised = append(raised, Alert{Job: job, Reason: reason})
+		}
+	}
+	if len(raised) > 0 {
+		NotifyAlerts(raised)
+	}
+}
+
 // Single call - Run without terminal user interface, just list the received jobs and quit
 func singleCall(remotes []Remote) {
 	width, _ := terminalSize()
 	// If not a tty, disable color
 	color := IsTTY()
 
+	// Machine-readable output is collected and printed after fetching
+	records := make([]JobRecord, 0)
+
 	// Fetch jobs and list them
+	fetchDetails = true
 	_, err := FetchJobs(remotes, func(id int64, job gopenqa.Job) {
-		PrintJob(job, color, width)
+		switch config.Output {
+		case "json":
+			records = append(records, CreateJobRecord(id, job))
+		case "ndjson":
+			if err := PrintJobNDJSON(CreateJobRecord(id, job)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing job %d: %s\n", job.ID, err)
+			}
+		default:
+			PrintJob(job, color, width)
+		}
 	})
+	if config.Output == "json" {
+		if err := PrintJobsJSON(records); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing jobs: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error fetching jobs: %s\n", err)
 		os.Exit(1)
 	}
 }
 
+// Merge the polled job into jobs. id is the originally requested job ID, the job might have been replaced by its clone via RabbitMQ already
+// Returns the updated jobs, the previous job and true, or an empty job and false if the job is new
+func mergePolledJob(jobs []gopenqa.Job, id int64, job gopenqa.Job) ([]gopenqa.Job, gopenqa.Job, bool) {
+	for _, match := range []int64{id, job.ID} {
+		for i, j := range jobs {
+			if j.ID == match && j.Remote == job.Remote {
+				jobs[i] = job
+				return jobs, j, true
+			}
+		}
+	}
+	return append(jobs, job), gopenqa.Job{}, false
+}
+
 func continuousMonitoring(remotes []Remote) {
 	var err error
+	// Progress and timing of the jobs are displayed
+	fetchDetails = true
 	// Ensure cursor is visible after termination
 	go func() {
 		sigs := make(chan os.Signal, 1)
@@ -834,32 +1266,119 @@ func continuousMonitoring(remotes []Remote) {
 	// Signal for a refresh
 	refreshSignal := make(chan int, 1)
 
+	// Trigger a refresh, unless one is already pending
+	refresh := func() {
+		select {
+		case refreshSignal <- 1:
+		default:
+		}
+	}
+
+	// Ask the user for confirmation of the given action. The action is executed if the next key is 'y'
+	var confirmAction func()
+	confirm := func(question string, action func()) {
+		confirmAction = action
+		tui.SetStatus(question + " [y/N]")
+	}
+
 	// Keybress callback
 	p := make([]byte, 3) // History, needed for special keys
 	tui.Keypress = func(b byte) {
 		p[2], p[1], p[0] = p[1], p[0], b
 
+		if confirmAction != nil {
+			action := confirmAction
+			confirmAction = nil
+			if b == 'y' || b == 'Y' {
+				go action()
+			} else {
+				tui.SetStatus("Aborted")
+			}
+			return
+		}
+
 		// Handle special keys
 		if p[2] == 27 && p[1] == 91 {
-			switch p[0] {
-			case 72: // home
-				tui.FirstPage()
-			case 70: // end
-				tui.LastPage()
-			case 53: // page up
-				tui.PrevPage()
-			case 54: // page down
-				tui.NextPage()
-			case 68: // arrow left
-				tui.PrevPage()
-			case 67: // arrow right
-				tui.NextPage()
-			}
+			tui.NavigationKey(p[0])
+		} else if tui.DoShowDetails() && b != 27 && b != 91 {
+			// Any key returns from the job details
+			tui.SetShowDetails(false)
 		} else {
 			switch b {
 			case 'q':
 				tui.LeaveAltScreen()
 				os.Exit(0)
+			case 'j':
+				tui.CursorDown()
+			case 'k':
+				tui.CursorUp()
+			case 'i', '\n', '\r':
+				if _, ok := tui.SelectedJob(); ok {
+					tui.SetShowDetails(true)
+				}
+			case 'o':
+				if job, ok := tui.SelectedJob(); ok {
+					if err := openBrowser(job.Link); err != nil {
+						tui.SetStatus(fmt.Sprintf("error: %s", err))
+					} else {
+						tui.SetStatus(fmt.Sprintf("Opened %s", job.Link))
+					}
+				}
+			case 'y':
+				if job, ok := tui.SelectedJob(); ok {
+					if err := copyToClipboard(job.Link); err != nil {
+						tui.SetStatus(fmt.Sprintf("error: %s", err))
+					} else {
+						tui.SetStatus(fmt.Sprintf("Copied %s", job.Link))
+					}
+				}
+			case 'x':
+				if job, ok := tui.SelectedJob(); ok {
+					tui.Model.Drop(job)
+					tui.SetStatus(fmt.Sprintf("Job %d removed from watch list", job.ID))
+				}
+			case 'R':
+				if job, ok := tui.SelectedJob(); ok {
+					confirm(fmt.Sprintf("Restart job %d %s?", job.ID, job.Test), func() {
+						if clone, err := RestartJob(job); err != nil {
+							tui.SetStatus(fmt.Sprintf("Error restarting job %d: %s", job.ID, err))
+						} else {
+							tui.SetStatus(fmt.Sprintf("Job %d restarted as %d", job.ID, clone))
+							refresh()
+						}
+					})
+				}
+			case 'F':
+				failed := getFailedJobs(tui.Model.Jobs())
+				if len(failed) == 0 {
+					tui.SetStatus("No failed jobs")
+				} else {
+					confirm(fmt.Sprintf("Restart %d failed job(s)?", len(failed)), func() {
+						restarted := 0
+						for _, job := range failed {
+							if _, err := RestartJob(job); err != nil {
+								tui.SetStatus(fmt.Sprintf("Error restarting job %d: %s", job.ID, err))
+							} else {
+								restarted++
+							}
+						}
+						if restarted == len(failed) {
+							tui.SetStatus(fmt.Sprintf("%d job(s) restarted", restarted))
+						}
+						refresh()
+					})
+				}
+			case 'C':
+				if job, ok := tui.SelectedJob(); ok {
+					confirm(fmt.Sprintf("Cancel job %d %s?", job.ID, job.Test), func() {
+						if err := CancelJob(job); err != nil {
+							tui.SetStatus(fmt.Sprintf("Error cancelling job %d: %s", job.ID, err))
+						} else {
+							tui.SetStatus(fmt.Sprintf("Job %d cancelled", job.ID))
+							refresh()
+						}
+					})
+				}
 			case 'r':
 				// Refresh
 				refreshSignal <- 1
@@ -910,39 +1429,19 @@ func continuousMonitoring(remotes []Remote) {
 	// Start TUI handlers (keypress, ecc)
 	tui.Start()
 
-	// Register RabbitMQ
-	config.Paused = false // Pause pulling new stats, if all remotes are present as RabbitMQ hosts
+	// Register RabbitMQ. If all remotes are present as RabbitMQ hosts, polling is only needed for reconciliation
+	config.Paused = false
+	config.Hybrid = false
 	if config.RabbitMQ {
-
-		rabbits, err := ReadRabbitMQs()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading rabbitmq configuration: %s\n", err)
-			// This error is non-critical for now, as the fallback to pull the stats is still working
-		}
-
-		// Try to register to all remotes. Unpause if we fail on at least one
-		config.Paused = true
-
-		for _, remote := range remotes {
-			openqaURI := remote.URI
-			hostname := getHostname(openqaURI)
-			if rabbit, ok := rabbits[hostname]; ok {
-				// generic queues that should work with all openQA instances
-				// Note: "#.job.cancel" is included in "#.job.done"
-				// Note: There are no messages that signal when a job is started
-				queue := []string{"#.job.done", "#.job.restart"}
-				remote := assembleRabbitMQRemote(rabbit.Remote, rabbit.Username, rabbit.Password)
-				rabbitmq, err := registerRabbitMQ(tui, openqaURI, remote, queue)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error establishing link to RabbitMQ %s: %s\n", rabbit.Remote, err)
-					config.Paused = false
-				}
-				defer rabbitmq.Close()
-			} else {
-				config.Paused = false
-				fmt.Fprintf(os.Stderr, "No RabbitMQ available for %s\n", hostname)
-			}
+		connections, complete := connectRabbitMQs(remotes, func(openqaURI string, remote string, keys []string) (gopenqa.RabbitMQ, error) {
+			return registerRabbitMQ(tui, openqaURI, remote, keys, refresh)
+		})
+		for _, rabbitmq := range connections {
+			defer rabbitmq.Close()
 		}
+		config.Hybrid = complete
+		// Without reconciliation, pulling new stats is paused entirely
+		config.Paused = config.Hybrid && config.Reconcile <= 0
 	}
 
 	// Current state of the jobs
@@ -955,76 +1454,118 @@ func continuousMonitoring(remotes []Remote) {
 			SetStatus()
 		} else {
 			force = false
+			tui.Model.Refresh()
+			// Monitor the jobs that have been added via RabbitMQ from now on
+			for _, job := range tui.Model.TakeAdded() {
+				remotes = appendJobRemote(remotes, job)
+			}
+			// The model is the only source of truth, as it is also updated via RabbitMQ. Polled jobs are compared to the model
+			jobs = tui.Model.Jobs()
+			source := "poll"
+			if config.Hybrid {
+				source = "reconcile"
+			}
 			exists := make(map[int64]bool, 0)    // Keep track of existing jobs
 			notifyJobs := make([]gopenqa.Job, 0) // jobs which fire a notification
 			// Fetch new jobs. Update remotes (job id's) when necessary
 			remotes, err = FetchJobs(remotes, func(id int64, job gopenqa.Job) {
+				// Ignore jobs that have been removed from the watch list
+				if tui.Model.IsDropped(id, job.Remote) || tui.Model.IsDropped(job.ID, job.Remote) {
+					return
+				}
 				exists[job.ID] = true
+				tui.Model.Touch(job)
 				// Job received. Update existing job or add job if not yet present
-				for i, j := range jobs {
-					if j.ID == id { // Compare to given id as this is the original id (not the ID of a possible cloned job)
-						jobs[i] = job
-						// Ignore if job status remains the same
-						if j.JobState() == job.JobState() {
-							return
-						}
-						// Ignore trivial changes (uploading, assigned) and skipped jobs
-						state := job.JobState()
-						if state == "uploading" || state == "assigned" || state == "skipped" || state == "cancelled" {
-							return
-						}
-						// Notify about job update
-						notifyJobs = append(notifyJobs, job)
-						// Refresh tui after each job update
-						tui.Model.SetJobs(jobs)
-						tui.Update()
-						return
-					}
+				var old gopenqa.Job
+				var found bool
+				jobs, old, found = mergePolledJob(jobs, id, job)
+				logTransition(old, job, id, source)
+				// Ignore if job status remains the same
+				if found && old.JobState() == job.JobState() {
+					return
 				}
-
-				// Append new job
-				jobs = append(jobs, job)
+				if found {
+					// Notify about job update. The notification rules decide, if this change is relevant
+					notifyJobs = append(notifyJobs, job)
+				}
+				// Refresh tui after each job update
 				tui.Model.SetJobs(jobs)
 				tui.Update()
 			})
 			if len(notifyJobs) > 0 {
 				NotifyJobsChanged(notifyJobs)
 			}
+			// Don't fetch dropped jobs anymore. Remotes without remaining jobs are removed, as they would otherwise fall back to the overview
+			monitored := make([]Remote, 0)
+			for _, remote := range remotes {
+				n := len(remote.Jobs)
+				remote.Jobs = filterIDs(remote.Jobs, func(id int64) bool {
+					return !tui.Model.IsDropped(id, ensureHTTP(remote.URI))
+				})
+				if n == 0 || len(remote.Jobs) > 0 || len(remote.Params) > 0 {
+					monitored = append(monitored, remote)
+				}
+			}
+			remotes = monitored
 
-			// Remove items which are not present anymore - (e.g. old children)
+			// Remove items which are not present anymore - (e.g. old children). Jobs of remotes that could not be fetched are kept as stale
+			errs := AsFetchErrors(err)
+			SetRemoteErrors(errs)
 			jobs = uniqueJobs(filterJobs(jobs, func(job gopenqa.Job) bool {
 				_, ok := exists[job.ID]
-				return ok
+				return ok || errs[job.Remote] != nil
 			}))
 			tui.Model.SetJobs(jobs)
-			if err != nil {
-				tui.SetStatus(fmt.Sprintf("Error fetching jobs: %s", err))
+			UpdateJobMetrics(metrics, jobs)
+			refreshed(remotes, err)
+			// Errors are shown on the stale jobs, only errors of remotes without jobs need to be shown in the status line
+			for _, job := range jobs {
+				delete(errs, job.Remote)
+			}
+			if len(errs) > 0 {
+				tui.SetStatus(fmt.Sprintf("Error fetching jobs: %s", errs))
 			} else {
 				SetStatus()
 			}
+			if restarter.Enabled() {
+				remotes, jobs, err = autoRestartJobs(remotes, jobs, func(old, job gopenqa.Job, id int64) {
+					logTransition(old, job, id, "restart")
+					tui.SetStatus(fmt.Sprintf("Job %d restarted as %d", old.ID, job.ID))
+				})
+				if err != nil {
+					tui.SetStatus(err.Error())
+				}
+				tui.Model.SetJobs(jobs)
+			}
+			PruneCaches(jobs)
 			tui.Update()
 			// Terminate if all jobs are done
 			if config.Quit && jobsDone(jobs) {
 				tui.LeaveAltScreen()
-				failed := getFailedJobs(jobs)
-				if len(failed) > 0 {
-					fmt.Fprintf(os.Stderr, "%d job(s) completed with errors\n", len(failed))
-					for _, job := range failed {
-						fmt.Fprintf(os.Stderr, "%s\n", job.String())
+				if config.JUnitFile != "" {
+					if err := WriteJUnitReport(config.JUnitFile, jobs); err != nil {
+						fmt.Fprintf(os.Stderr, "Error writing JUnit report: %s\n", err)
 					}
-					os.Exit(1)
-				} else {
-					os.Exit(0)
 				}
+				if failed := getFailedJobs(jobs); len(failed) > 0 {
+					reportFailedJobs(failed)
+				}
+				os.Exit(config.Exit.ExitCode(jobs))
 			}
 		}
 
+		// Stuck jobs don't change their state, so they need to be checked also when there are no updates
+		if alerts.Enabled() {
+			checkAlerts(tui.Model.Jobs())
+			tui.Update()
+		}
+
 		// Wait for next update, or timeout or signal
 		select {
 		case <-refreshSignal:
 			tui.SetStatus("Manual refresh ... ")
 			force = true
-		case <-time.After(time.Duration(config.Continuous) * time.Second):
+		case <-time.After(time.Duration(pollInterval()) * time.Second):
 			tui.SetStatus("Refreshing ... ")
 		}
 
@@ -1,8 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
 )
 
 func TestAddRemoteFromCLI(t *testing.T) {
@@ -76,3 +89,803 @@ func TestShouldGiveError(t *testing.T) {
 		}
 	}
 }
+
+func TestJobRecord(t *testing.T) {
+	job := gopenqa.Job{ID: 12, Test: "textmode", Remote: "https://openqa.opensuse.org", Link: "https://openqa.opensuse.org/tests/12", Prefix: "  +"}
+	record := CreateJobRecord(10, job)
+	if !record.Followed || record.OriginalID != 10 || record.ID != 12 {
+		t.Error("Expected job 10 to be followed to 12, got", record)
+	}
+	if !record.Child || record.Prefix != "+" {
+		t.Error("Expected child job with prefix '+', got", record.Prefix)
+	}
+	buf, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal("Error marshalling job record:", err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(buf, &parsed); err != nil {
+		t.Fatal("Error parsing job record:", err)
+	}
+	for _, key := range []string{"id", "test", "remote", "link", "prefix", "original_id", "followed"} {
+		if _, ok := parsed[key]; !ok {
+			t.Error("Missing key in job record:", key)
+		}
+	}
+	for _, key := range []string{"Remote", "Link", "Prefix"} {
+		if _, ok := parsed[key]; ok {
+			t.Error("Duplicate key in job record:", key)
+		}
+	}
+	if parsed["prefix"] != "+" || parsed["remote"] != job.Remote {
+		t.Error("Unexpected prefix or remote in job record", parsed["prefix"], parsed["remote"])
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	jobs := []gopenqa.Job{
+		{ID: 1, Test: "textmode", State: "done", Result: "passed", Remote: "https://openqa.opensuse.org", Tstarted: "2025-02-12T10:00:00", Tfinished: "2025-02-12T10:30:00"},
+		{ID: 2, Test: "kde", State: "done", Result: "incomplete", Remote: "https://openqa.opensuse.org"},
+		{ID: 3, Test: "gnome", State: "cancelled", Remote: "https://openqa.suse.de"},
+	}
+	buf, err := CreateJUnitReport(jobs)
+	if err != nil {
+		t.Fatal("Error creating JUnit report:", err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf, &report); err != nil {
+		t.Fatal("Error parsing JUnit report:", err)
+	}
+	if report.Tests != 3 || report.Failures != 2 {
+		t.Error("Expected 3 tests with 2 failures, got", report.Tests, report.Failures)
+	}
+	if len(report.Suites) != 2 {
+		t.Fatal("Expected 2 testsuites, got", len(report.Suites))
+	}
+	if report.Suites[0].Cases[0].Time != 1800 {
+		t.Error("Expected a duration of 1800 seconds, got", report.Suites[0].Cases[0].Time)
+	}
+}
+
+func TestJobFormat(t *testing.T) {
+	jf, err := ParseJobFormat(`{{lpad 6 .ID}}|{{pad 6 .Test}}|{{trunc 3 .Settings.Machine}}|{{setting . "ARCH"}}|{{color .}}{{.JobState}}{{reset}}`)
+	if err != nil {
+		t.Fatal("Error parsing format:", err)
+	}
+	job := gopenqa.Job{ID: 42, Test: "kde", State: "done", Result: "passed", Settings: gopenqa.Settings{Arch: "x86_64", Machine: "64bit"}}
+	line, err := jf.Format(job, false)
+	if err != nil {
+		t.Fatal("Error formatting job:", err)
+	}
+	expected := "    42|kde   |64b|x86_64|passed"
+	if line != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, line)
+	}
+	line, _ = jf.Format(job, true)
+	if !strings.Contains(line, ANSI_GREEN+"passed"+ANSI_RESET) {
+		t.Error("Expected colored job state, got", line)
+	}
+	// Multi-byte characters are neither cut nor counted as multiple columns
+	job.Test, job.Settings.Machine = "ümlaut", "äöü64"
+	if line, _ = jf.Format(job, false); line != "    42|ümlaut|äöü|x86_64|passed" {
+		t.Error("Unexpected line with multi-byte characters:", line)
+	}
+	// Settings that are not part of the job are only shown once they are cached, without any request
+	jf, _ = ParseJobFormat(`{{.ID}} {{setting . "BUILD"}}`)
+	job = gopenqa.Job{ID: 43, Remote: "http://localhost:1"}
+	if line, _ := jf.Format(job, false); !jf.UsesSettings() || line != "43 " {
+		t.Error("Expected empty setting without request, got", line)
+	}
+	infoMutex.Lock()
+	infoCache[jobKey{Remote: job.Remote, ID: job.ID}] = jobInfo{Settings: map[string]string{"BUILD": "20250212"}}
+	infoMutex.Unlock()
+	if line, _ := jf.Format(job, false); line != "43 20250212" {
+		t.Error("Expected cached setting, got", line)
+	}
+	if _, err := ParseJobFormat("{{pad 8 .ID"); err == nil {
+		t.Error("Expected error for invalid template")
+	}
+}
+
+func TestBuildFilters(t *testing.T) {
+	remotes = make([]Remote, 0)
+	testargs := []string{"openqa-mon", "https://openqa.opensuse.org", "--build", "20250212", "--distri", "opensuse", "--group", "1", "--arch", "x86_64", "--arch", "aarch64", "--filter", "flavor=DVD", "--filter", "machine=a&b,c+d#e"}
+	if err := parseProgramArguments(testargs); err != nil {
+		t.Fatal("Error parsing command line:", err)
+	}
+	// Values are query-escaped, only repeated parameters are comma-separated
+	expected := map[string]string{"build": "20250212", "distri": "opensuse", "groupid": "1", "arch": "x86_64,aarch64", "flavor": "DVD", "machine": "a%26b%2Cc%2Bd%23e"}
+	if len(remotes) != 1 || !reflect.DeepEqual(remotes[0].Params, expected) {
+		t.Error("Expected params", expected, "got", remotes)
+	}
+
+	remotes = make([]Remote, 0)
+	if err := parseProgramArguments([]string{"openqa-mon", "https://openqa.opensuse.org", "--group", "openSUSE Tumbleweed"}); err != nil {
+		t.Fatal("Error parsing command line:", err)
+	}
+	if len(remotes) != 1 || remotes[0].Params["group"] != "openSUSE+Tumbleweed" {
+		t.Error("Expected escaped group name, got", remotes)
+	}
+
+	remotes = make([]Remote, 0)
+	testargs = []string{"openqa-mon", "https://openqa.opensuse.org/tests/overview?distri=opensuse&version=Tumbleweed&build=20250212"}
+	if err := parseProgramArguments(testargs); err != nil {
+		t.Fatal("Error parsing command line:", err)
+	}
+	expected = map[string]string{"build": "20250212", "distri": "opensuse", "version": "Tumbleweed"}
+	if len(remotes) != 1 || remotes[0].URI != "https://openqa.opensuse.org" || !reflect.DeepEqual(remotes[0].Params, expected) {
+		t.Error("Expected params", expected, "got", remotes)
+	}
+}
+
+func TestOverviewURLs(t *testing.T) {
+	tests := []struct {
+		url    string
+		remote string
+		params map[string]string
+	}{
+		{"https://openqa.opensuse.org/tests/overview?distri=opensuse&build=20261015", "https://openqa.opensuse.org", map[string]string{"distri": "opensuse", "build": "20261015"}},
+		{"https://openqa.opensuse.org/tests/overview?distri=opensuse&arch=x86_64&arch=aarch64&flavor=", "https://openqa.opensuse.org", map[string]string{"distri": "opensuse", "arch": "x86_64,aarch64"}},
+		{"https://openqa.opensuse.org/tests/overview?group=openSUSE%20Tumbleweed&build=a+b&flavor=DVD%26NET", "https://openqa.opensuse.org", map[string]string{"group": "openSUSE+Tumbleweed", "build": "a+b", "flavor": "DVD%26NET"}},
+		{"https://openqa.opensuse.org/tests/overview?machine=64bit%2Cuefi&machine=aarch64", "https://openqa.opensuse.org", map[string]string{"machine": "64bit%2Cuefi,aarch64"}},
+		{"https://openqa.opensuse.org/group_overview/1", "https://openqa.opensuse.org", map[string]string{"groupid": "1"}},
+		{"http://localhost:9526/openqa/group_overview/42/", "http://localhost:9526/openqa", map[string]string{"groupid": "42"}},
+	}
+	for _, tc := range tests {
+		match, remote, params := matchOverviewURL(tc.url)
+		if !match || remote != tc.remote || !reflect.DeepEqual(params, tc.params) {
+			t.Error("Unexpected result for", tc.url, ":", match, remote, params)
+		}
+	}
+	for _, url := range []string{"https://openqa.opensuse.org", "https://openqa.opensuse.org/t123", "https://openqa.opensuse.org/group_overview/abc"} {
+		if match, _, _ := matchOverviewURL(url); match {
+			t.Error("Unexpected match for", url)
+		}
+	}
+
+	// Overview links are also supported in input files
+	filename := t.TempDir() + "/jobs"
+	if err := os.WriteFile(filename, []byte("# openQA jobs\nhttps://openqa.opensuse.org/t123\nhttps://openqa.opensuse.org/group_overview/1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remotes, err := readJobs(filename)
+	if err != nil {
+		t.Fatal("Error reading jobs:", err)
+	}
+	if len(remotes) != 1 || !reflect.DeepEqual(remotes[0].Jobs, []int64{123}) || remotes[0].Params["groupid"] != "1" {
+		t.Error("Unexpected remotes from input file:", remotes)
+	}
+}
+
+func TestJobProgress(t *testing.T) {
+	modules := []testModule{{"bootloader", "installation", "passed"}, {"welcome", "installation", "softfailed"}, {"partitioning", "installation", "failed"}, {"install", "installation", "running"}, {"reboot", "installation", "none"}}
+	progress := CreateJobProgress(modules)
+	expected := JobProgress{Current: "install", Passed: 2, Failed: 1, Total: 5}
+	if progress != expected {
+		t.Error("Expected", expected, "got", progress)
+	}
+	if progress.String() != "[install 2/5, 1 failed]" {
+		t.Error("Unexpected progress string:", progress.String())
+	}
+	if s := CreateJobProgress(modules[:2]).String(); s != "[2/2]" {
+		t.Error("Unexpected progress string without running module:", s)
+	}
+}
+
+func TestJobTiming(t *testing.T) {
+	if s := formatDuration(45 * time.Second); s != "45s" {
+		t.Error("Expected 45s, got", s)
+	}
+	if s := formatDuration(62 * time.Minute); s != "1h02m" {
+		t.Error("Expected 1h02m, got", s)
+	}
+
+	history := []gopenqa.Job{{Tstarted: "2024-01-01T10:00:00", Tfinished: "2024-01-01T11:00:00"}, {Tstarted: "2024-01-01T10:00:00", Tfinished: "2024-01-01T10:30:00"}, {Tstarted: "2024-01-01T10:00:00", Tfinished: "2024-01-01T12:00:00"}, {Tstarted: "2024-01-01T10:00:00"}}
+	if duration := medianDuration(history); duration != time.Hour {
+		t.Error("Expected median duration of 1h, got", duration)
+	}
+
+	now := time.Date(2024, 1, 2, 10, 20, 0, 0, time.UTC)
+	job := gopenqa.Job{ID: 1, State: "running", Test: "textmode", Remote: "http://localhost", Tstarted: "2024-01-02T10:00:00"}
+	job.Settings.Machine = "64bit"
+	if timing := JobTiming(job, now); timing != "running 20m" {
+		t.Error("Expected timing without ETA, got", timing)
+	}
+	settings := map[string]string{"DISTRI": "opensuse", "VERSION": "Tumbleweed", "FLAVOR": "DVD"}
+	infoCache[jobKey{Remote: job.Remote, ID: job.ID}] = jobInfo{Settings: settings}
+	durationCache[createScenarioKey(job, settings)] = time.Hour
+	if timing := JobTiming(job, now); timing != "running 20m, ETA 40m" {
+		t.Error("Expected timing with ETA, got", timing)
+	}
+	if timing := JobTiming(job, now.Add(2*time.Hour)); timing != "running 2h20m, overdue 1h20m" {
+		t.Error("Expected overdue job, got", timing)
+	}
+}
+
+func TestAlertMonitor(t *testing.T) {
+	am := CreateAlertMonitor()
+	am.Uploading = 10 * time.Minute
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	job := gopenqa.Job{ID: 1, State: "uploading", Remote: "http://localhost", Tstarted: "2024-01-02T08:00:00"}
+	if _, ok := am.Check(job, now); ok {
+		t.Error("Expected no alert for a job that just started uploading")
+	}
+	if reason, ok := am.Check(job, now.Add(11*time.Minute)); !ok || reason != "uploading for 11m" {
+		t.Error("Expected alert for a stuck upload, got", reason)
+	}
+	// Alerts are raised only once per state
+	if _, ok := am.Check(job, now.Add(20*time.Minute)); ok {
+		t.Error("Expected no repeated alert")
+	}
+	if reason, ok := am.Alerted(job); !ok || reason != "uploading for 11m" {
+		t.Error("Expected job to remain alerted, got", reason)
+	}
+	job.State, job.Result = "done", "passed"
+	if _, ok := am.Check(job, now.Add(21*time.Minute)); ok {
+		t.Error("Expected no alert for a finished job")
+	}
+	if _, ok := am.Alerted(job); ok {
+		t.Error("Expected alert to be cleared after a state change")
+	}
+	// Disabled rules never alert
+	job = gopenqa.Job{ID: 2, State: "scheduled", Remote: "http://localhost"}
+	if _, ok := am.Check(job, now.Add(24*time.Hour)); ok || am.Scheduled != 0 {
+		t.Error("Expected no alert for disabled rule")
+	}
+	// Jobs that are not monitored anymore are forgotten
+	am.Prune([]gopenqa.Job{job})
+	if len(am.states) != 1 {
+		t.Error("Expected only the state of the monitored job to be kept, got", am.states)
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	filename := t.TempDir() + "/events.ndjson"
+	log, err := OpenEventLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	old := gopenqa.Job{ID: 1, State: "running", Remote: "http://localhost"}
+	job := gopenqa.Job{ID: 2, State: "scheduled", Remote: "http://localhost"}
+	if IsTransition(old, old) || !IsTransition(old, job) {
+		t.Error("Unexpected transition detection")
+	}
+	if err := log.Write(CreateEvent(gopenqa.Job{}, old, 1, "poll", now)); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Write(CreateEvent(old, job, 1, "rabbitmq", now)); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected two events, got", lines)
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	expected := Event{Timestamp: "2024-01-02T10:00:00Z", Remote: "http://localhost", ID: 2, OriginalID: 1, PreviousID: 1, OldState: "running", NewState: "scheduled", Source: "rabbitmq"}
+	if event != expected {
+		t.Error("Expected", expected, "got", event)
+	}
+}
+
+func TestJobMetrics(t *testing.T) {
+	metrics = CreateMonitorMetrics()
+	jobs := []gopenqa.Job{
+		{ID: 1, State: "done", Result: "failed", Remote: "http://localhost"},
+		{ID: 2, State: "done", Result: "failed", Remote: "http://localhost"},
+		{ID: 3, State: "running", Result: "none", Remote: "http://localhost"},
+	}
+	UpdateJobMetrics(metrics, jobs)
+	UpdateJobMetrics(metrics, jobs[:2])
+
+	var buf strings.Builder
+	if err := metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `openqa_mon_jobs{remote="http://localhost",state="done",result="failed"} 2`) {
+		t.Error("Missing job count in metrics", buf.String())
+	}
+	if strings.Contains(buf.String(), `state="running"`) {
+		t.Error("Stale job count in metrics", buf.String())
+	}
+
+	metrics = CreateMonitorMetrics()
+	refreshed([]Remote{{URI: "http://localhost"}, {URI: "http://remote/"}}, FetchErrors{"http://remote": fmt.Errorf("timeout")})
+	buf.Reset()
+	if err := metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `openqa_mon_fetch_errors_total{remote="http://localhost"} 0`) || !strings.Contains(buf.String(), `openqa_mon_fetch_errors_total{remote="http://remote"} 1`) {
+		t.Error("Unexpected fetch errors in metrics", buf.String())
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	daemon := CreateDaemon(make([]Remote, 0))
+	if resp := daemon.Handle(DaemonRequest{Command: "add", Jobs: []int64{1}}); resp.Error == "" {
+		t.Error("Expected error when adding jobs without remote")
+	}
+	if resp := daemon.Handle(DaemonRequest{Command: "add", Remote: "http://localhost", Jobs: []int64{1, 2}}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if resp := daemon.Handle(DaemonRequest{Command: "add", Remote: "http://remote", Params: map[string]string{"build": "42"}}); resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if resp := daemon.Handle(DaemonRequest{Command: "restart"}); resp.Error == "" {
+		t.Error("Expected error for unknown command")
+	}
+	daemon.jobs = []gopenqa.Job{{ID: 1, Remote: "http://localhost"}, {ID: 2, Remote: "http://localhost"}}
+
+	// Remove jobs via the control socket
+	socket := t.TempDir() + "/openqa-mon.sock"
+	listener, err := daemon.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if _, err := daemon.Listen(socket); err == nil {
+		t.Error("Expected error when listening on the socket of a running daemon")
+	}
+	if _, err := DaemonCall(socket, DaemonRequest{Command: "remove", Remote: "http://localhost", Jobs: []int64{1}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := DaemonCall(socket, DaemonRequest{Command: "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Jobs) != 1 || resp.Jobs[0].ID != 2 {
+		t.Error("Expected only job 2 after removal, got", resp.Jobs)
+	}
+	remotes := daemon.Remotes()
+	if len(remotes) != 2 || !reflect.DeepEqual(remotes[0].Jobs, []int64{2}) || remotes[1].Params["build"] != "42" {
+		t.Error("Unexpected remotes", remotes)
+	}
+}
+
+func TestDaemonSubscription(t *testing.T) {
+	daemon := CreateDaemon(make([]Remote, 0))
+	daemon.jobs = []gopenqa.Job{{ID: 1, Remote: "http://localhost"}}
+	client, server := net.Pipe()
+	defer client.Close()
+	go daemon.serveSubscription(server, json.NewEncoder(server))
+	decoder := json.NewDecoder(client)
+	var resp DaemonResponse
+	if err := decoder.Decode(&resp); err != nil || len(resp.Jobs) != 1 {
+		t.Fatal("Expected the current jobs, got", resp, err)
+	}
+
+	// A client that does not keep up is dropped with an error instead of silently
+	daemon.mutex.Lock()
+	for i := 0; i < 2*subscriberBuffer; i++ {
+		event := Event{ID: int64(i), Remote: "http://localhost", NewState: "running"}
+		daemon.broadcast(DaemonResponse{Event: &event})
+	}
+	daemon.mutex.Unlock()
+	events := 0
+	for {
+		var resp DaemonResponse
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatal("Expected an error response before the end of the subscription, got", err)
+		}
+		if resp.Error != "" {
+			break
+		}
+		if resp.Event == nil || resp.Jobs != nil {
+			t.Fatal("Expected only the event, got", resp)
+		}
+		events++
+	}
+	if events < subscriberBuffer || events >= 2*subscriberBuffer {
+		t.Error("Unexpected number of events before the subscription has been dropped:", events)
+	}
+}
+
+func TestFetchJobs(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobs := make([]gopenqa.Job, 0)
+		for _, id := range r.URL.Query()["ids"] {
+			jobs = append(jobs, gopenqa.Job{ID: int64(len(id)), State: "done", Result: "passed"})
+		}
+		json.NewEncoder(w).Encode(map[string][]gopenqa.Job{"jobs": jobs})
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	defer func(cf Config) { config = cf }(config)
+	config.Follow, config.Hierarchy = false, false
+	remotes := []Remote{{URI: bad.URL, Jobs: []int64{1}}, {URI: good.URL, Jobs: []int64{1}}}
+	fetched := make([]gopenqa.Job, 0)
+	_, err := FetchJobs(remotes, func(id int64, job gopenqa.Job) {
+		fetched = append(fetched, job)
+	})
+	errs := AsFetchErrors(err)
+	if len(errs) != 1 || errs[bad.URL] == nil {
+		t.Fatal("Expected fetch error only for the unavailable remote, got", err)
+	}
+	if len(fetched) != 1 || fetched[0].Remote != good.URL {
+		t.Fatal("Expected the job of the available remote, got", fetched)
+	}
+
+	SetRemoteErrors(errs)
+	defer SetRemoteErrors(nil)
+	if RemoteError(gopenqa.Job{Remote: bad.URL}) == nil || RemoteError(fetched[0]) != nil {
+		t.Error("Expected only jobs of the unavailable remote to be stale")
+	}
+}
+
+func TestFetchJobDetails(t *testing.T) {
+	var mutex sync.Mutex
+	current, concurrent := 0, 0 // Concurrent detail requests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/jobs" {
+			jobs := make([]gopenqa.Job, 0)
+			for _, id := range r.URL.Query()["ids"] {
+				id, _ := strconv.ParseInt(id, 10, 64)
+				jobs = append(jobs, gopenqa.Job{ID: id, State: "scheduled"})
+			}
+			json.NewEncoder(w).Encode(map[string][]gopenqa.Job{"jobs": jobs})
+			return
+		}
+		mutex.Lock()
+		current++
+		concurrent = max(concurrent, current)
+		mutex.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mutex.Lock()
+		current--
+		mutex.Unlock()
+		fmt.Fprint(w, `{"job":{"t_created":"2025-02-12T10:00:00","settings":{"BUILD":"42"}}}`)
+	}))
+	defer server.Close()
+
+	defer func(cf Config) { config = cf }(config)
+	config.Follow, config.Hierarchy = false, false
+	fetchDetails = true
+	defer func() { fetchDetails = false }()
+	remotes := []Remote{{URI: server.URL, Jobs: []int64{1, 2, 3, 4}}}
+	fetched := make([]gopenqa.Job, 0)
+	if _, err := FetchJobs(remotes, func(id int64, job gopenqa.Job) {
+		fetched = append(fetched, job)
+	}); err != nil {
+		t.Fatal("Error fetching jobs:", err)
+	}
+	for _, job := range fetched {
+		if info, ok := cachedJobInfo(job); !ok || info.Settings["BUILD"] != "42" {
+			t.Error("Expected cached job info for job", job.ID)
+		}
+	}
+	if len(fetched) != 4 || concurrent < 2 {
+		t.Error("Expected the details of 4 jobs to be fetched concurrently, got", len(fetched), concurrent)
+	}
+}
+
+func TestJobAge(t *testing.T) {
+	tui := CreateTUI()
+	job := gopenqa.Job{ID: 1, Remote: "http://localhost"}
+	tui.Model.Refresh()
+	tui.Model.Touch(job)
+	if age := tui.Model.Age(job); age != 0 {
+		t.Error("Expected age 0 for updated job, got", age)
+	}
+	tui.Model.Refresh()
+	tui.Model.Refresh()
+	if age := tui.Model.Age(job); age != 2 {
+		t.Error("Expected age 2 after two refreshes without update, got", age)
+	}
+	if age := tui.Model.Age(gopenqa.Job{ID: 2}); age != 0 {
+		t.Error("Expected age 0 for unknown job, got", age)
+	}
+}
+
+func TestJobSelection(t *testing.T) {
+	tui := CreateTUI()
+	job1 := gopenqa.Job{ID: 1, Remote: "http://localhost"}
+	job2 := gopenqa.Job{ID: 2, Remote: "http://localhost"}
+	job3 := gopenqa.Job{ID: 3, Remote: "http://localhost"}
+	tui.Model.SetJobs([]gopenqa.Job{job1, job2, job3})
+	tui.CursorDown()
+	tui.SetShowDetails(true)
+	// The selection follows the job, if the list is reordered
+	tui.Model.SetJobs([]gopenqa.Job{job3, job1, job2})
+	if jobs, cursor, details := tui.snapshot(); !details || jobs[cursor].ID != 2 {
+		t.Error("Expected details of job 2, got", jobs[cursor].ID, details)
+	}
+	// The details are closed, if the job is gone
+	tui.Model.SetJobs([]gopenqa.Job{job1})
+	if jobs, cursor, details := tui.snapshot(); details || jobs[cursor].ID != 1 {
+		t.Error("Expected closed details and job 1 to be selected, got", jobs[cursor].ID, details)
+	}
+	tui.Model.SetJobs([]gopenqa.Job{})
+	if _, ok := tui.SelectedJob(); ok {
+		t.Error("Expected no selected job")
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	defer func(cf Config) { config = cf }(config)
+	config.Continuous = 30
+	config.Reconcile = 300
+	config.Hybrid = false
+	if interval := pollInterval(); interval != 30 {
+		t.Error("Expected polling interval of 30 seconds without RabbitMQ, got", interval)
+	}
+	config.Hybrid = true
+	if interval := pollInterval(); interval != 300 {
+		t.Error("Expected reconciliation interval of 300 seconds in RabbitMQ mode, got", interval)
+	}
+	config.Continuous = 600
+	if interval := pollInterval(); interval != 600 {
+		t.Error("Expected reconciliation not to be faster than the polling interval, got", interval)
+	}
+}
+
+func TestRabbitMQTopics(t *testing.T) {
+	filename := t.TempDir() + "/rabbitmq.conf"
+	conf := "[openqa.opensuse.org]\nRemote = amqps://rabbit.opensuse.org\nQueue = opensuse.openqa\nTopics = job.create, comment.create\n\n[localhost]\n"
+	if err := os.WriteFile(filename, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rabbits, err := ReadRabbitMQ(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rabbits) != 2 {
+		t.Fatal("Expected two RabbitMQ configurations, got", rabbits)
+	}
+	expected := []string{"opensuse.openqa.job.done", "opensuse.openqa.job.restart", "opensuse.openqa.job.create", "opensuse.openqa.comment.create"}
+	if keys := rabbits[0].RoutingKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Error("Expected routing keys", expected, "got", keys)
+	}
+	// Without queue prefix, the topics of all instances are matched
+	expected = []string{"#.job.done", "#.job.restart"}
+	if keys := rabbits[1].RoutingKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Error("Expected routing keys", expected, "got", keys)
+	}
+	if topic := rabbitTopic("opensuse.openqa.job.create"); topic != "job.create" {
+		t.Error("Expected topic job.create, got", topic)
+	}
+
+	if err := os.WriteFile(filename, []byte("[localhost]\nTopics = job.start\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRabbitMQ(filename); err == nil {
+		t.Error("Expected error for unsupported topic")
+	}
+}
+
+func TestRabbitDispatcher(t *testing.T) {
+	remote := "http://localhost"
+	tui := CreateTUI()
+	tui.Model.SetJobs([]gopenqa.Job{{ID: 1, State: "running", Remote: remote}, {ID: 2, State: "scheduled", Remote: remote}, {ID: 3, State: "running", Remote: remote}})
+	updates := 0
+	dispatcher := RabbitDispatcher{Remote: remote, Model: &tui.Model, Follow: true}
+	dispatcher.Fetch = func(id int64) (gopenqa.Job, error) {
+		job := gopenqa.Job{ID: id, State: "scheduled", Remote: remote}
+		job.Parents.Chained = []int64{2}
+		return job, nil
+	}
+	dispatcher.Updated = func(old, job gopenqa.Job, id int64) { updates++ }
+	dispatcher.Status = func(status string) {}
+
+	dispatch := func(key string, body string) {
+		event, err := ParseRabbitEvent(key, []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event == nil || event.Topic() != rabbitTopic(key) {
+			t.Fatal("Unexpected event for", key, event)
+		}
+		dispatcher.Dispatch(event)
+	}
+	dispatch("suse.openqa.job.done", `{"id":"1","result":"passed"}`)
+	if job, _ := tui.Model.Job(1, remote); job.JobState() != "passed" {
+		t.Error("Expected job 1 to be passed, got", job.JobState())
+	}
+	// Duplicated jobs are remapped to their clone
+	dispatch("suse.openqa.job.duplicate", `{"id":3,"result":30}`)
+	if _, found := tui.Model.Job(3, remote); found {
+		t.Error("Expected job 3 to be replaced by its clone")
+	}
+	if job, found := tui.Model.Job(30, remote); !found || job.State != "scheduled" {
+		t.Error("Expected scheduled clone 30, got", job)
+	}
+	dispatch("suse.openqa.job.cancel", `{"id":30}`)
+	if job, _ := tui.Model.Job(30, remote); job.State != "cancelled" {
+		t.Error("Expected job 30 to be cancelled, got", job.State)
+	}
+	// Children of monitored jobs are added
+	dispatch("suse.openqa.job.create", `{"id":4}`)
+	if added := tui.Model.TakeAdded(); len(added) != 1 || added[0].ID != 4 {
+		t.Error("Expected job 4 to be added, got", added)
+	}
+	dispatch("suse.openqa.comment.create", `{"id":100,"job_id":2,"text":"label:force_result:softfailed:poo#12345 bsc#42"}`)
+	if refs := JobBugrefs(gopenqa.Job{ID: 2, Remote: remote}); !reflect.DeepEqual(refs, []string{"poo#12345", "bsc#42"}) {
+		t.Error("Expected bugrefs of job 2, got", refs)
+	}
+	if updates != 4 {
+		t.Error("Expected 4 job updates, got", updates)
+	}
+}
+
+func TestReconcileAfterRabbitMQ(t *testing.T) {
+	remote := "http://localhost"
+	tui := CreateTUI()
+	tui.Model.SetJobs([]gopenqa.Job{{ID: 1, State: "running", Remote: remote}, {ID: 2, State: "running", Remote: remote}})
+	transitions := 0
+	dispatcher := RabbitDispatcher{Remote: remote, Model: &tui.Model, Follow: true}
+	dispatcher.Updated = func(old, job gopenqa.Job, id int64) {
+		if IsTransition(old, job) {
+			transitions++
+		}
+	}
+	dispatcher.Status = func(status string) {}
+	dispatcher.Dispatch(JobDoneEvent{ID: 1, Result: "passed"})
+	dispatcher.Dispatch(JobDuplicateEvent{ID: 2, Clones: map[int64]int64{2: 20}})
+
+	// The reconcile poll compares to the model, so transitions via RabbitMQ are not reported again
+	jobs := tui.Model.Jobs()
+	for _, job := range []gopenqa.Job{{ID: 1, State: "done", Result: "passed", Remote: remote}, {ID: 20, State: "scheduled", Result: "none", Remote: remote}} {
+		var old gopenqa.Job
+		var found bool
+		jobs, old, found = mergePolledJob(jobs, job.ID, job)
+		if !found {
+			t.Error("Expected job", job.ID, "to be known from RabbitMQ")
+		}
+		if IsTransition(old, job) {
+			transitions++
+		}
+	}
+	if transitions != 2 || len(jobs) != 2 {
+		t.Error("Expected only the 2 transitions via RabbitMQ, got", transitions, jobs)
+	}
+}
+
+func TestWaitForJobs(t *testing.T) {
+	defer func(cf Config) { config = cf }(config)
+	config.SetDefaults()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		job := gopenqa.Job{ID: 1, State: "running"}
+		if calls > 1 {
+			job.State, job.Result = "done", "failed"
+		}
+		json.NewEncoder(w).Encode(map[string][]gopenqa.Job{"jobs": {job}})
+	}))
+	defer server.Close()
+
+	config.Follow, config.Hierarchy, config.RabbitMQ = false, false, false
+	config.Continuous, config.Timeout, config.Output = 1, 0, "text"
+	var out strings.Builder
+	if code := waitForJobs([]Remote{{URI: server.URL, Jobs: []int64{1}}}, &out); code != 1 {
+		t.Error("Expected exit code 1 for failed job, got", code)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "/tests/1 running") || !strings.HasSuffix(lines[1], "/tests/1 running -> failed") {
+		t.Error("Unexpected transitions", lines)
+	}
+
+	// Jobs that don't finish in time
+	calls = -100
+	config.Timeout = 10 * time.Millisecond
+	if code := waitForJobs([]Remote{{URI: server.URL, Jobs: []int64{1}}}, &out); code != EXIT_TIMEOUT {
+		t.Error("Expected timeout exit code, got", code)
+	}
+}
+
+func TestExitPolicy(t *testing.T) {
+	policy := CreateExitPolicy()
+	policy.Incomplete = 3
+	passed := gopenqa.Job{ID: 1, State: "done", Result: "passed"}
+	softfailed := gopenqa.Job{ID: 2, State: "done", Result: "softfailed"}
+	incomplete := gopenqa.Job{ID: 3, State: "done", Result: "incomplete"}
+	failed := gopenqa.Job{ID: 4, State: "done", Result: "failed"}
+	cancelled := gopenqa.Job{ID: 5, State: "cancelled", Result: "user_cancelled"}
+	parallel := gopenqa.Job{ID: 6, State: "done", Result: "parallel_failed"}
+	if code := policy.ExitCode([]gopenqa.Job{passed, softfailed}); code != 0 {
+		t.Error("Expected passed and softfailed jobs to succeed, got", code)
+	}
+	if code := policy.ExitCode([]gopenqa.Job{passed, incomplete}); code != 3 {
+		t.Error("Expected exit code 3 for only incomplete jobs, got", code)
+	}
+	if code := policy.ExitCode([]gopenqa.Job{incomplete, failed}); code != 1 {
+		t.Error("Expected exit code 1 for failed jobs, got", code)
+	}
+	if code := policy.ExitCode([]gopenqa.Job{passed, cancelled}); code != 1 {
+		t.Error("Expected cancelled jobs to fail by default, got", code)
+	}
+	policy.Ignored = []string{"cancelled", "parallel_failed"}
+	if code := policy.ExitCode([]gopenqa.Job{passed, cancelled, parallel}); code != 0 {
+		t.Error("Expected ignored jobs not to fail, got", code)
+	}
+	policy.Accepted = []string{"passed"}
+	if failed := policy.FailedJobs([]gopenqa.Job{passed, softfailed}); len(failed) != 1 || failed[0].ID != 2 {
+		t.Error("Expected only softfailed job to fail, got", failed)
+	}
+	// Return codes are validated in the config file as on the command line
+	var cf Config
+	filename := t.TempDir() + "/openqa-mon.conf"
+	for _, value := range []string{"256", "-1", "abc"} {
+		os.WriteFile(filename, []byte("ExitFailed = "+value+"\n"), 0644)
+		if err := cf.ReadFile(filename); err == nil {
+			t.Error("Expected error for return code", value)
+		}
+	}
+	os.WriteFile(filename, []byte("ExitIncomplete = 3\n"), 0644)
+	if err := cf.ReadFile(filename); err != nil || cf.Exit.Incomplete != 3 {
+		t.Error("Expected return code 3, got", cf.Exit.Incomplete, err)
+	}
+}
+
+func TestAutoRestarter(t *testing.T) {
+	defer func(r *AutoRestarter) { restarter = r }(restarter)
+	restarter = CreateAutoRestarter(2, false)
+	next := int64(100)
+	restarter.Restart = func(job gopenqa.Job) (int64, error) {
+		next++
+		return next, nil
+	}
+	remote := "http://openqa.example.com"
+	remotes := []Remote{{URI: remote, Jobs: []int64{1, 2}}}
+	incomplete := gopenqa.Job{ID: 1, Remote: remote, State: "done", Result: "incomplete"}
+	failed := gopenqa.Job{ID: 2, Remote: remote, State: "done", Result: "failed"}
+
+	restarts := 0
+	transition := func(old, job gopenqa.Job, id int64) { restarts++ }
+	remotes, jobs, err := autoRestartJobs(remotes, []gopenqa.Job{incomplete, failed}, transition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarts != 1 || jobs[0].ID != 101 || jobs[0].State != "scheduled" || jobs[1].ID != 2 {
+		t.Fatal("Expected only the incomplete job to be restarted, got", jobs)
+	}
+	if remotes[0].Jobs[0] != 101 {
+		t.Error("Expected the clone to be monitored, got", remotes[0].Jobs)
+	}
+	// The clone is incomplete again and restarted once more, then the maximum is reached
+	for i := 0; i < 2; i++ {
+		jobs[0].State, jobs[0].Result = "done", "incomplete"
+		remotes, jobs, _ = autoRestartJobs(remotes, jobs, transition)
+	}
+	if restarts != 2 || jobs[0].ID != 102 {
+		t.Fatal("Expected two restarts, got", restarts, jobs[0].ID)
+	}
+	if chain := formatChain(restarter.Chain(jobs[0])); chain != "1 -> 101 -> 102" {
+		t.Error("Unexpected retry chain", chain)
+	}
+	if retries := restarter.Retries(jobs[0]); retries != 2 {
+		t.Error("Expected 2 retries, got", retries)
+	}
+	policy := CreateExitPolicy()
+	if code := policy.ExitCode(jobs); code != 1 {
+		t.Error("Expected the last attempt to decide the exit code, got", code)
+	}
+
+	// Failed restart attempts count against the maximum
+	attempts := 0
+	restarter.Restart = func(job gopenqa.Job) (int64, error) {
+		attempts++
+		return 0, fmt.Errorf("restart failed")
+	}
+	jobs = []gopenqa.Job{failed, {ID: 3, Remote: remote, State: "done", Result: "incomplete"}}
+	for i := 0; i < 3; i++ {
+		if _, jobs, err = autoRestartJobs(remotes, jobs, transition); err == nil && i < 2 {
+			t.Error("Expected restart error")
+		}
+	}
+	if attempts != 2 || jobs[1].ID != 3 {
+		t.Error("Expected two failed restart attempts, got", attempts)
+	}
+}
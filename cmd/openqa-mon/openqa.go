@@ -0,0 +1,532 @@
+/* openQA related methods and functions for openqa-mon, which are not covered by gopenqa */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+	"github.com/os-autoinst/openqa-mon/internal"
+)
+
+// jobKey identifies a job across multiple remotes
+type jobKey struct {
+	Remote string
+	ID     int64
+}
+
+// Reusable openQA instances and API credentials per remote
+var instances = internal.CreateInstances("openqa-mon", 100) // Certain jobs (e.g. verification runs) can have a lot of clones
+
+// Bounds the number of concurrent requests to the openQA instances
+var requests = make(requestPool, 4)
+
+// Errors of the last fetch by remote. The jobs of these remotes are stale
+var remoteErrors = make(FetchErrors, 0)
+var remoteErrorsMutex sync.Mutex
+
+// Fetch the additional information for displaying progress and timing of the jobs in FetchJobs (see FetchJobDetails)
+var fetchDetails = false
+
+// Static job information never changes, so it is fetched only once per job
+var infoCache = make(map[jobKey]jobInfo, 0)
+var infoMutex sync.Mutex
+
+// Typical durations of passed jobs per scenario. Fetched only once per scenario
+var durationCache = make(map[scenarioKey]time.Duration, 0)
+var durationMutex sync.Mutex
+
+// Bug references from comments on the jobs
+var bugrefCache = make(map[jobKey][]string, 0)
+var bugrefMutex sync.Mutex
+
+// Matches bug references in comments, e.g. poo#123, bsc#1234 or gh#os-autoinst/openqa-mon#42
+var bugrefRegexp = regexp.MustCompile(`\b(?:poo|bsc|boo|bnc|kde|fdo|jsc|lp|gh|gl|gio)#(?:[\w.-]+/[\w.-]+#)?\d+\b`)
+
+// requestPool limits the number of concurrent requests to its capacity
+type requestPool chan struct{}
+
+// FetchErrors contains the errors of the remotes that could not be fetched, by remote
+type FetchErrors map[string]error
+
+// jobInfo contains the job information that is not part of gopenqa.Job
+type jobInfo struct {
+	Settings map[string]string `json:"settings"`
+	Tcreated string            `json:"t_created"`
+}
+
+// scenarioKey identifies all jobs of the same scenario on a remote
+type scenarioKey struct {
+	Remote  string
+	Distri  string
+	Version string
+	Flavor  string
+	Arch    string
+	Machine string
+	Test    string
+}
+
+// fetchJSON performs a GET request on the given url and unmarshals the returned json into v
+func fetchJSON(url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "openqa-mon")
+	c := http.Client{Timeout: 60 * time.Second}
+	r, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != 200 {
+		return fmt.Errorf("http status code %d", r.StatusCode)
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// getJobInfo returns the static information of the given job. The information is fetched from the job's remote on first use and cached afterwards
+func getJobInfo(job gopenqa.Job) (jobInfo, error) {
+	key := jobKey{Remote: job.Remote, ID: job.ID}
+	if info, ok := cachedJobInfo(job); ok {
+		return info, nil
+	}
+
+	// The cache is not locked during the request, so that other jobs are not blocked
+	type ResultJob struct { // Expected result structure
+		Job jobInfo `json:"job"`
+	}
+	var result ResultJob
+	if err := fetchJSON(fmt.Sprintf("%s/api/v1/jobs/%d", ensureHTTP(job.Remote), job.ID), &result); err != nil {
+		return jobInfo{Settings: make(map[string]string, 0)}, err
+	}
+	if result.Job.Settings == nil {
+		result.Job.Settings = make(map[string]string, 0)
+	}
+	infoMutex.Lock()
+	defer infoMutex.Unlock()
+	infoCache[key] = result.Job
+	return result.Job, nil
+}
+
+// cachedJobInfo returns the static information of the given job, if already fetched. Does not perform any request
+func cachedJobInfo(job gopenqa.Job) (jobInfo, bool) {
+	infoMutex.Lock()
+	defer infoMutex.Unlock()
+	info, ok := infoCache[jobKey{Remote: job.Remote, ID: job.ID}]
+	return info, ok
+}
+
+// GetJobSettings returns all settings of the given job. The settings are fetched from the job's remote on first use and cached afterwards
+func GetJobSettings(job gopenqa.Job) (map[string]string, error) {
+	info, err := getJobInfo(job)
+	return info.Settings, err
+}
+
+// Returns the value of a setting that is already part of the job and true, or false if the setting requires a request
+func staticJobSetting(job gopenqa.Job, name string) (string, bool) {
+	switch name {
+	case "ARCH":
+		return job.Settings.Arch, true
+	case "BACKEND":
+		return job.Settings.Backend, true
+	case "MACHINE":
+		return job.Settings.Machine, true
+	case "TEST":
+		return job.Test, true
+	}
+	return "", false
+}
+
+// CachedJobSetting returns the value of a single job setting and true, or false if the settings of the job have not been fetched yet. Does not perform any request
+func CachedJobSetting(job gopenqa.Job, name string) (string, bool) {
+	if value, ok := staticJobSetting(job, name); ok {
+		return value, true
+	}
+	info, ok := cachedJobInfo(job)
+	return info.Settings[name], ok
+}
+
+// GetJobSetting returns the value of a single job setting, or an empty string if not present.
+// Settings that are already part of the job don't require a request to the remote.
+func GetJobSetting(job gopenqa.Job, name string) (string, error) {
+	if value, ok := staticJobSetting(job, name); ok {
+		return value, nil
+	}
+	settings, err := GetJobSettings(job)
+	if err != nil {
+		return "", err
+	}
+	return settings[name], nil
+}
+
+// RestartJob restarts the given job and returns the ID of the new clone, or 0 if it is not known
+func RestartJob(job gopenqa.Job) (int64, error) {
+	type RestartResult struct {
+		Result json.RawMessage `json:"result"`
+		Errors []string        `json:"errors"`
+	}
+	var result RestartResult
+	if err := instances.Post(job.Remote, fmt.Sprintf("/api/v1/jobs/%d/restart", job.ID), &result); err != nil {
+		return 0, err
+	}
+	if len(result.Errors) > 0 {
+		return 0, fmt.Errorf("%s", strings.Join(result.Errors, ", "))
+	}
+	// Recent openQA versions return a mapping of the restarted jobs to their clones. Older versions only the clone IDs
+	var mapping []map[string]int64
+	if err := json.Unmarshal(result.Result, &mapping); err != nil {
+		return 0, nil
+	}
+	for _, clones := range mapping {
+		if clone, ok := clones[fmt.Sprintf("%d", job.ID)]; ok {
+			return clone, nil
+		}
+	}
+	return 0, nil
+}
+
+// CancelJob cancels the given job
+func CancelJob(job gopenqa.Job) error {
+	return instances.Post(job.Remote, fmt.Sprintf("/api/v1/jobs/%d/cancel", job.ID), nil)
+}
+
+// JobProgress summarizes the test modules of a running job
+type JobProgress struct {
+	Current string `json:"current"` // Currently executing test module, empty if none is executing
+	Passed  int    `json:"passed"`  // Number of passed (or softfailed) test modules
+	Failed  int    `json:"failed"`  // Number of failed test modules
+	Total   int    `json:"total"`   // Total number of test modules
+}
+
+// testModule is a single entry of the test results of a job
+type testModule struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Result   string `json:"result"`
+}
+
+// Progress of the running jobs, as determined by the last call to GetJobProgress
+var progressCache = make(map[jobKey]JobProgress, 0)
+var progressMutex sync.Mutex
+
+// CreateJobProgress summarizes the given test modules
+func CreateJobProgress(modules []testModule) JobProgress {
+	progress := JobProgress{Total: len(modules)}
+	for _, module := range modules {
+		switch module.Result {
+		case "running":
+			progress.Current = module.Name
+		case "passed", "softfailed":
+			progress.Passed++
+		case "failed":
+			progress.Failed++
+		}
+	}
+	return progress
+}
+
+// String returns the short progress representation, e.g. "[bootloader 12/40, 1 failed]"
+func (progress JobProgress) String() string {
+	ret := fmt.Sprintf("%d/%d", progress.Passed, progress.Total)
+	if progress.Current != "" {
+		ret = progress.Current + " " + ret
+	}
+	if progress.Failed > 0 {
+		ret += fmt.Sprintf(", %d failed", progress.Failed)
+	}
+	return "[" + ret + "]"
+}
+
+// GetJobProgress fetches the test results of the given job from its remote and returns the current progress
+func GetJobProgress(job gopenqa.Job) (JobProgress, error) {
+	type ResultJob struct { // Expected result structure
+		Job struct {
+			TestResults []testModule `json:"testresults"`
+		} `json:"job"`
+	}
+	var result ResultJob
+	if err := fetchJSON(fmt.Sprintf("%s/api/v1/jobs/%d/details", ensureHTTP(job.Remote), job.ID), &result); err != nil {
+		return JobProgress{}, err
+	}
+	progress := CreateJobProgress(result.Job.TestResults)
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	progressCache[jobKey{Remote: job.Remote, ID: job.ID}] = progress
+	return progress, nil
+}
+
+// CachedJobProgress returns the last known progress of the given job, if it is running. Does not perform any request
+func CachedJobProgress(job gopenqa.Job) (JobProgress, bool) {
+	if job.State != "running" {
+		return JobProgress{}, false
+	}
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	progress, ok := progressCache[jobKey{Remote: job.Remote, ID: job.ID}]
+	return progress, ok
+}
+
+// Create the scenario key of the given job from its settings
+func createScenarioKey(job gopenqa.Job, settings map[string]string) scenarioKey {
+	return scenarioKey{Remote: job.Remote, Distri: settings["DISTRI"], Version: settings["VERSION"], Flavor: settings["FLAVOR"], Arch: job.Settings.Arch, Machine: job.Settings.Machine, Test: job.Test}
+}
+
+// medianDuration returns the median duration of the given jobs, ignoring jobs without a known duration
+func medianDuration(jobs []gopenqa.Job) time.Duration {
+	durations := make([]float64, 0)
+	for _, job := range jobs {
+		if duration := jobDuration(job); duration > 0 {
+			durations = append(durations, duration)
+		}
+	}
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Float64s(durations)
+	return time.Duration(durations[len(durations)/2] * float64(time.Second))
+}
+
+// GetScenarioDuration returns the typical duration of the scenario of the given job, determined from the recent passed jobs of the same scenario.
+// Returns 0 if there are no recent passed jobs. The duration is fetched once per scenario and cached afterwards
+func GetScenarioDuration(job gopenqa.Job) (time.Duration, error) {
+	settings, err := GetJobSettings(job)
+	if err != nil {
+		return 0, err
+	}
+	key := createScenarioKey(job, settings)
+	durationMutex.Lock()
+	duration, ok := durationCache[key]
+	durationMutex.Unlock()
+	if ok {
+		return duration, nil
+	}
+
+	// The cache is not locked during the request, so that other scenarios are not blocked
+	params := url.Values{}
+	params.Set("result", "passed")
+	params.Set("limit", "10")
+	for name, value := range map[string]string{"distri": key.Distri, "version": key.Version, "flavor": key.Flavor, "arch": key.Arch, "machine": key.Machine, "test": key.Test} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	type ResultJobs struct { // Expected result structure
+		Jobs []gopenqa.Job `json:"jobs"`
+	}
+	var result ResultJobs
+	if err := fetchJSON(fmt.Sprintf("%s/api/v1/jobs?%s", ensureHTTP(job.Remote), params.Encode()), &result); err != nil {
+		return 0, err
+	}
+	duration = medianDuration(result.Jobs)
+	durationMutex.Lock()
+	defer durationMutex.Unlock()
+	durationCache[key] = duration
+	return duration, nil
+}
+
+// CachedScenarioDuration returns the typical duration of the scenario of the given job, if already fetched and known. Does not perform any request
+func CachedScenarioDuration(job gopenqa.Job) (time.Duration, bool) {
+	info, ok := cachedJobInfo(job)
+	if !ok {
+		return 0, false
+	}
+	durationMutex.Lock()
+	defer durationMutex.Unlock()
+	duration, ok := durationCache[createScenarioKey(job, info.Settings)]
+	return duration, ok && duration > 0
+}
+
+// PruneCaches removes the cached information of jobs that are not among the given monitored jobs anymore, and of their scenarios
+func PruneCaches(jobs []gopenqa.Job) {
+	keys := make(map[jobKey]bool, len(jobs))
+	scenarios := make(map[scenarioKey]bool, 0)
+	for _, job := range jobs {
+		keys[jobKey{Remote: job.Remote, ID: job.ID}] = true
+		if info, ok := cachedJobInfo(job); ok {
+			scenarios[createScenarioKey(job, info.Settings)] = true
+		}
+	}
+	infoMutex.Lock()
+	for key := range infoCache {
+		if !keys[key] {
+			delete(infoCache, key)
+		}
+	}
+	infoMutex.Unlock()
+	progressMutex.Lock()
+	for key := range progressCache {
+		if !keys[key] {
+			delete(progressCache, key)
+		}
+	}
+	progressMutex.Unlock()
+	durationMutex.Lock()
+	for key := range durationCache {
+		if !scenarios[key] {
+			delete(durationCache, key)
+		}
+	}
+	durationMutex.Unlock()
+	alerts.Prune(jobs)
+}
+
+// JobElapsed returns the time the given job spent in its current state so far, and false if unknown
+func JobElapsed(job gopenqa.Job, now time.Time) (time.Duration, bool) {
+	var since string
+	switch job.State {
+	case "running", "uploading":
+		since = job.Tstarted
+	case "scheduled", "assigned", "setup":
+		if info, ok := cachedJobInfo(job); ok {
+			since = info.Tcreated
+		}
+	}
+	t, err := parseTimestamp(since)
+	if err != nil || now.Before(t) {
+		return 0, false
+	}
+	return now.Sub(t), true
+}
+
+// JobRemaining returns the estimated remaining time of the given running job, and false if unknown.
+// A negative duration indicates that the job takes already longer than usual
+func JobRemaining(job gopenqa.Job, now time.Time) (time.Duration, bool) {
+	if job.State != "running" {
+		return 0, false
+	}
+	elapsed, ok := JobElapsed(job, now)
+	if !ok {
+		return 0, false
+	}
+	duration, ok := CachedScenarioDuration(job)
+	if !ok {
+		return 0, false
+	}
+	return duration - elapsed, true
+}
+
+// JobTiming returns the short timing representation of the given job, e.g. "running 1h02m, ETA 35m". Returns an empty string if unknown
+func JobTiming(job gopenqa.Job, now time.Time) string {
+	elapsed, ok := JobElapsed(job, now)
+	if !ok {
+		return ""
+	}
+	ret := fmt.Sprintf("%s %s", job.State, formatDuration(elapsed))
+	if remaining, ok := JobRemaining(job, now); ok {
+		if remaining < 0 {
+			ret += fmt.Sprintf(", overdue %s", formatDuration(-remaining))
+		} else {
+			ret += fmt.Sprintf(", ETA %s", formatDuration(remaining))
+		}
+	}
+	return ret
+}
+
+// FetchJobDetails fetches the additional information for the given job that is required to display its progress and timing.
+// All information is cached, so that displaying the job does not require any request. Errors are not fatal, the information is just not shown
+// Called by FetchJobs within the request pool, if fetchDetails is enabled
+func FetchJobDetails(job gopenqa.Job) {
+	switch job.State {
+	case "running":
+		GetJobProgress(job)
+		GetScenarioDuration(job)
+	case "scheduled", "assigned", "setup":
+		getJobInfo(job)
+	default:
+		// The settings of all jobs are displayed by the job format
+		if jobFormat != nil && jobFormat.UsesSettings() {
+			getJobInfo(job)
+		}
+	}
+}
+
+// Do executes f, once a request slot is available
+func (pool requestPool) Do(f func()) {
+	pool <- struct{}{}
+	defer func() { <-pool }()
+	f()
+}
+
+// Parallel executes task for 0 <= i < n concurrently, with at most the capacity of the pool at once. Returns when all tasks are done
+func (pool requestPool) Parallel(n int, task func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Do(func() { task(i) })
+		}()
+	}
+	wg.Wait()
+}
+
+func (errs FetchErrors) Error() string {
+	remotes := make([]string, 0)
+	for remote := range errs {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+	msgs := make([]string, 0)
+	for _, remote := range remotes {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", internal.Hostname(remote), errs[remote]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AsFetchErrors returns the errors by remote of an error returned by FetchJobs
+func AsFetchErrors(err error) FetchErrors {
+	if errs, ok := err.(FetchErrors); ok {
+		return errs
+	}
+	return make(FetchErrors, 0)
+}
+
+// SetRemoteErrors replaces the errors of the last fetch. The jobs of remotes with errors are marked as stale
+func SetRemoteErrors(errs FetchErrors) {
+	remoteErrorsMutex.Lock()
+	defer remoteErrorsMutex.Unlock()
+	remoteErrors = make(FetchErrors, 0)
+	for remote, err := range errs {
+		remoteErrors[remote] = err
+	}
+}
+
+// RemoteError returns the error of the last fetch of the remote of the given job, or nil if the job is up to date
+func RemoteError(job gopenqa.Job) error {
+	remoteErrorsMutex.Lock()
+	defer remoteErrorsMutex.Unlock()
+	return remoteErrors[job.Remote]
+}
+
+// ParseBugrefs returns the bug references in the given comment text
+func ParseBugrefs(text string) []string {
+	return unique(bugrefRegexp.FindAllString(text, -1))
+}
+
+// AddJobBugrefs adds the given bug references to the job
+func AddJobBugrefs(job gopenqa.Job, refs []string) {
+	bugrefMutex.Lock()
+	defer bugrefMutex.Unlock()
+	key := jobKey{Remote: job.Remote, ID: job.ID}
+	bugrefCache[key] = unique(append(bugrefCache[key], refs...))
+}
+
+// JobBugrefs returns the bug references of the comments on the job
+func JobBugrefs(job gopenqa.Job) []string {
+	bugrefMutex.Lock()
+	defer bugrefMutex.Unlock()
+	return bugrefCache[jobKey{Remote: job.Remote, ID: job.ID}]
+}
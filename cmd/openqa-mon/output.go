@@ -0,0 +1,93 @@
+/* Machine-readable output formats for openqa-mon */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// JobRecord is the machine-readable representation of a fetched job, as written in the json and ndjson output modes
+type JobRecord struct {
+	gopenqa.Job `json:"-"`   // Marshalled separately, see MarshalJSON
+	Remote      string       `json:"remote"`              // openQA instance the job belongs to
+	Link        string       `json:"link"`                // Link to the job in the web UI
+	Prefix      string       `json:"prefix"`              // Hierarchy prefix ("+" for directly chained or parallel, "." for chained children)
+	Child       bool         `json:"child"`               // true if the job has been fetched as a child of a monitored job
+	OriginalID  int64        `json:"original_id"`         // ID of the requested job
+	Followed    bool         `json:"followed"`            // true if the requested job has been replaced by its clone
+	Progress    *JobProgress `json:"progress,omitempty"`  // Test module progress, only for running jobs
+	Elapsed     *float64     `json:"elapsed,omitempty"`   // Seconds in the current state, if known
+	Remaining   *float64     `json:"remaining,omitempty"` // Estimated remaining seconds of a running job, if known. Negative if the job takes longer than usual
+}
+
+// CreateJobRecord assembles the output record for the given job. id is the originally requested job ID
+func CreateJobRecord(id int64, job gopenqa.Job) JobRecord {
+	record := JobRecord{Job: job, Remote: job.Remote, Link: job.Link, OriginalID: id}
+	record.Prefix = strings.TrimSpace(job.Prefix)
+	record.Child = record.Prefix != ""
+	record.Followed = id != job.ID
+	if progress, ok := CachedJobProgress(job); ok {
+		record.Progress = &progress
+	}
+	now := time.Now()
+	if elapsed, ok := JobElapsed(job, now); ok {
+		seconds := elapsed.Seconds()
+		record.Elapsed = &seconds
+	}
+	if remaining, ok := JobRemaining(job, now); ok {
+		seconds := remaining.Seconds()
+		record.Remaining = &seconds
+	}
+	return record
+}
+
+// The fields of gopenqa.Job that are set by the program and have no json tags. They are replaced by their lowercase counterparts in JobRecord
+var untaggedJobFields = []string{"Link", "Prefix", "Remote"}
+
+// MarshalJSON writes the job and the record fields as a single json object
+func (record JobRecord) MarshalJSON() ([]byte, error) {
+	type recordFields JobRecord // Without this method, to avoid the recursion
+	fields := make(map[string]json.RawMessage, 0)
+	buf, err := json.Marshal(record.Job)
+	if err != nil {
+		return buf, err
+	}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return buf, err
+	}
+	for _, key := range untaggedJobFields {
+		delete(fields, key)
+	}
+	buf, err = json.Marshal(recordFields(record))
+	if err != nil {
+		return buf, err
+	}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return buf, err
+	}
+	return json.Marshal(fields)
+}
+
+// PrintJobsJSON prints all given records as a single json array to stdout
+func PrintJobsJSON(records []JobRecord) error {
+	buf, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(buf))
+	return nil
+}
+
+// PrintJobNDJSON prints the given record as a single json line to stdout
+func PrintJobNDJSON(record JobRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(buf))
+	return nil
+}
@@ -0,0 +1,391 @@
+/* RabbitMQ events of openQA and how they are applied to the monitored jobs */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// RabbitEvent is a parsed RabbitMQ message of openQA. See ParseRabbitEvent
+type RabbitEvent interface {
+	Topic() string
+}
+
+// JobDoneEvent is sent when a job is finished, including cancelled jobs
+type JobDoneEvent struct {
+	ID     int64
+	Result string
+}
+
+// JobCancelEvent is sent when a job is cancelled
+type JobCancelEvent struct {
+	ID int64
+}
+
+// JobRestartEvent is sent when jobs are restarted. Clones maps the restarted jobs to their clones, if known
+type JobRestartEvent struct {
+	IDs    []int64
+	Clones map[int64]int64
+}
+
+// JobDuplicateEvent is sent when a job is duplicated, e.g. by a automatic retry. Clones maps the job to its clone, if known
+type JobDuplicateEvent struct {
+	ID     int64
+	Clones map[int64]int64
+}
+
+// JobCreateEvent is sent when a new job is created
+type JobCreateEvent struct {
+	ID int64
+}
+
+// CommentEvent is sent when a comment is created
+type CommentEvent struct {
+	JobID int64 // 0 for comments on job groups
+	Text  string
+}
+
+func (e JobDoneEvent) Topic() string      { return "job.done" }
+func (e JobCancelEvent) Topic() string    { return "job.cancel" }
+func (e JobRestartEvent) Topic() string   { return "job.restart" }
+func (e JobDuplicateEvent) Topic() string { return "job.duplicate" }
+func (e JobCreateEvent) Topic() string    { return "job.create" }
+func (e CommentEvent) Topic() string      { return "comment.create" }
+
+// RabbitMQ message of openQA. The IDs are sometimes sent as strings (poo#114529) and are lists for restarted jobs
+type rabbitMessage struct {
+	ID     interface{} `json:"id"`     // Job ID(s), or comment ID for comment events
+	JobID  interface{} `json:"job_id"` // Job ID of comment events
+	Result interface{} `json:"result"` // Job result, or the clones of restarted and duplicated jobs
+	Text   string      `json:"text"`   // Comment text
+}
+
+// ParseRabbitEvent parses the given RabbitMQ message into its typed event. Returns nil and no error for messages that are not relevant
+func ParseRabbitEvent(key string, body []byte) (RabbitEvent, error) {
+	var msg rabbitMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	ids := parseIDs(msg.ID)
+	// Ignore empty updates
+	if len(ids) == 0 || ids[0] == 0 {
+		return nil, nil
+	}
+	switch rabbitTopic(key) {
+	case "job.done":
+		result, _ := msg.Result.(string)
+		return JobDoneEvent{ID: ids[0], Result: result}, nil
+	case "job.cancel":
+		return JobCancelEvent{ID: ids[0]}, nil
+	case "job.restart":
+		return JobRestartEvent{IDs: ids, Clones: parseClones(ids, msg.Result)}, nil
+	case "job.duplicate":
+		return JobDuplicateEvent{ID: ids[0], Clones: parseClones(ids, msg.Result)}, nil
+	case "job.create":
+		return JobCreateEvent{ID: ids[0]}, nil
+	case "comment.create":
+		ids := parseIDs(msg.JobID)
+		if len(ids) == 0 {
+			return CommentEvent{Text: msg.Text}, nil
+		}
+		return CommentEvent{JobID: ids[0], Text: msg.Text}, nil
+	}
+	return nil, nil
+}
+
+// Parse a single job ID or a list of job IDs, which can be numbers or strings
+func parseIDs(value interface{}) []int64 {
+	ids := make([]int64, 0)
+	switch v := value.(type) {
+	case float64:
+		ids = append(ids, int64(v))
+	case string:
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	case []interface{}:
+		for _, item := range v {
+			ids = append(ids, parseIDs(item)...)
+		}
+	}
+	return ids
+}
+
+// Parse the clones of a restarted or duplicated job. The result is either the ID of the clone of a single job,
+// a map of the jobs to their clones or a list of such maps
+func parseClones(ids []int64, result interface{}) map[int64]int64 {
+	clones := make(map[int64]int64, 0)
+	switch v := result.(type) {
+	case float64, string:
+		if clone := parseIDs(v); len(ids) == 1 && len(clone) == 1 {
+			clones[ids[0]] = clone[0]
+		}
+	case map[string]interface{}:
+		for job, clone := range v {
+			id, err := strconv.ParseInt(job, 10, 64)
+			if clone := parseIDs(clone); err == nil && len(clone) == 1 {
+				clones[id] = clone[0]
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			for id, clone := range parseClones(ids, item) {
+				clones[id] = clone
+			}
+		}
+	}
+	return clones
+}
+
+// RabbitDispatcher applies the events of a single openQA instance to the model
+type RabbitDispatcher struct {
+	Remote  string                               // openQA instance of the events, as in gopenqa.Job.Remote
+	Model   *TUIModel                            // Model of the monitored jobs
+	Follow  bool                                 // Replace jobs by their clones
+	Fetch   func(id int64) (gopenqa.Job, error)  // Fetch a job from the openQA instance
+	Updated func(old, job gopenqa.Job, id int64) // Called after a monitored job has been updated
+	Status  func(status string)                  // Display a status message
+}
+
+// Dispatch applies the given event to the model
+func (d *RabbitDispatcher) Dispatch(event RabbitEvent) {
+	switch e := event.(type) {
+	case JobDoneEvent:
+		d.Status(fmt.Sprintf("Job %d - %s", e.ID, e.Result))
+		d.update(e.ID, func(job *gopenqa.Job) {
+			job.State = "done"
+			job.Result = e.Result
+		})
+	case JobCancelEvent:
+		d.update(e.ID, func(job *gopenqa.Job) {
+			// The result follows with the job.done event
+			if job.State != "done" {
+				job.State = "cancelled"
+			}
+		})
+	case JobRestartEvent:
+		for _, id := range e.IDs {
+			d.cloned(id, e.Clones[id])
+		}
+	case JobDuplicateEvent:
+		d.cloned(e.ID, e.Clones[e.ID])
+	case JobCreateEvent:
+		d.created(e.ID)
+	case CommentEvent:
+		refs := ParseBugrefs(e.Text)
+		if len(refs) == 0 {
+			return
+		}
+		if job, found := d.Model.Job(e.JobID, d.Remote); found {
+			AddJobBugrefs(job, refs)
+			d.Status(fmt.Sprintf("Job %d - %s", job.ID, strings.Join(refs, ", ")))
+		}
+	}
+}
+
+// Apply the given update to the monitored job with the given id
+func (d *RabbitDispatcher) update(id int64, f func(job *gopenqa.Job)) {
+	if old, job, found := d.Model.Update(id, d.Remote, f); found {
+		d.Updated(old, job, id)
+	}
+}
+
+// Apply the clone of a restarted or duplicated job. Without a known clone, the job is fetched again
+func (d *RabbitDispatcher) cloned(id int64, clone int64) {
+	old, found := d.Model.Job(id, d.Remote)
+	if !found {
+		return
+	}
+	if clone == 0 {
+		job, err := d.Fetch(id)
+		if err != nil {
+			d.Status(fmt.Sprintf("Error fetching job %d: %s", id, err))
+			return
+		}
+		d.Model.Replace(id, d.Remote, job)
+		d.Updated(old, job, id)
+		return
+	}
+	if !d.Follow {
+		d.update(id, func(job *gopenqa.Job) { job.CloneID = clone })
+		return
+	}
+	job := scheduledClone(old, clone)
+	d.Model.Replace(id, d.Remote, job)
+	d.Updated(old, job, id)
+}
+
+// Add the created job, if it is a child of a monitored job
+func (d *RabbitDispatcher) created(id int64) {
+	if _, found := d.Model.Job(id, d.Remote); found {
+		return
+	}
+	job, err := d.Fetch(id)
+	if err != nil {
+		return
+	}
+	parents := make([]int64, 0)
+	parents = append(parents, job.Parents.Chained...)
+	parents = append(parents, job.Parents.DirectlyChained...)
+	parents = append(parents, job.Parents.Parallel...)
+	for _, parent := range parents {
+		if _, found := d.Model.Job(parent, d.Remote); found {
+			job.Remote = d.Remote
+			if d.Model.Add(job) {
+				d.Status(fmt.Sprintf("Job %d created", id))
+				d.Updated(gopenqa.Job{}, job, id)
+			}
+			return
+		}
+	}
+}
+
+// Connect to the RabbitMQ servers of all remotes via register. Returns the connections and true, if all remotes are covered by RabbitMQ
+func connectRabbitMQs(remotes []Remote, register func(openqaURI string, remote string, keys []string) (gopenqa.RabbitMQ, error)) ([]gopenqa.RabbitMQ, bool) {
+	connections := make([]gopenqa.RabbitMQ, 0)
+	rabbits, err := ReadRabbitMQs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading rabbitmq configuration: %s\n", err)
+		// This error is non-critical for now, as the fallback to pull the stats is still working
+	}
+
+	// Try to register to all remotes. Polling is still required if we fail on at least one
+	complete := true
+	for _, remote := range remotes {
+		openqaURI := remote.URI
+		hostname := getHostname(openqaURI)
+		// Query-based remotes need to be polled, as RabbitMQ doesn't notify us about newly created jobs
+		if len(remote.Params) > 0 {
+			complete = false
+		}
+		if rabbit, ok := rabbits[hostname]; ok {
+			// Note: There are no messages that signal when a job is started
+			remote := assembleRabbitMQRemote(rabbit.Remote, rabbit.Username, rabbit.Password)
+			rabbitmq, err := register(openqaURI, remote, rabbit.RoutingKeys())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error establishing link to RabbitMQ %s: %s\n", rabbit.Remote, err)
+				complete = false
+				continue
+			}
+			connections = append(connections, rabbitmq)
+		} else {
+			complete = false
+			fmt.Fprintf(os.Stderr, "No RabbitMQ available for %s\n", hostname)
+		}
+	}
+	return connections, complete
+}
+
+// Register the given rabbitMQ instance for the tui and subscribe on the given routing keys
+// refresh triggers a poll of all jobs, e.g. after every reconnect, as messages might have been missed in the meantime
+func registerRabbitMQ(tui *TUI, openqaURI string, remote string, keys []string, refresh func()) (gopenqa.RabbitMQ, error) {
+	dispatcher := CreateRabbitDispatcher(openqaURI, &tui.Model)
+	dispatcher.Status = tui.SetStatus
+	dispatcher.Updated = func(old, job gopenqa.Job, id int64) {
+		logTransition(old, job, id, "rabbitmq")
+		// Jobs are restarted on the next poll
+		if restarter.Wants(job) {
+			refresh()
+		}
+		tui.Model.Touch(job)
+		UpdateJobMetrics(metrics, tui.Model.Jobs())
+		tui.Update()
+		if config.Notify {
+			jobs := make([]gopenqa.Job, 0)
+			jobs = append(jobs, job)
+			NotifyJobsChanged(jobs)
+		}
+	}
+	return subscribeRabbitMQ(dispatcher, openqaURI, remote, keys, refresh)
+}
+
+// CreateRabbitDispatcher creates the dispatcher for the events of the given openQA instance. Updated and Status need to be set by the caller
+func CreateRabbitDispatcher(openqaURI string, model *TUIModel) *RabbitDispatcher {
+	dispatcher := RabbitDispatcher{Remote: ensureHTTP(homogenizeRemote(openqaURI)), Model: model, Follow: config.Follow}
+	dispatcher.Fetch = func(id int64) (gopenqa.Job, error) {
+		return instances.Get(openqaURI).GetJobFollow(id)
+	}
+	return &dispatcher
+}
+
+// Connect to the given RabbitMQ server and pass the events on the given routing keys to the dispatcher. Reconnects when the connection breaks
+func subscribeRabbitMQ(dispatcher *RabbitDispatcher, openqaURI string, remote string, keys []string, refresh func()) (gopenqa.RabbitMQ, error) {
+	rmq, err := gopenqa.ConnectRabbitMQ(remote)
+	if err != nil {
+		return rmq, fmt.Errorf("RabbitMQ connection error: %s", err)
+	}
+
+	recvFunction := func(rmq *gopenqa.RabbitMQ) {
+		connectedFlag := make(chan int)
+		reconnects := 0
+		metrics.Add("openqa_mon_rabbitmq_reconnects_total", 0, "remote", openqaURI)
+
+		// Loop until closed
+		for !rmq.Closed() {
+			// Subscribe to all routing keys in their own goroutine.
+			// subscriptions notify us via the connectedFlag channel about error events.
+			for _, key := range keys {
+				go func(key string) {
+					sub, err := rmq.Subscribe(key)
+					if err != nil {
+						dispatcher.Status(fmt.Sprintf("RabbitMQ subscribe error: %s", err))
+						connectedFlag <- 0 // Notify that something's off
+						return
+					}
+
+					for {
+						d, err := sub.Receive()
+						if err != nil {
+							// Receive failed
+							dispatcher.Status(fmt.Sprintf("rabbitmq recv error: %s", err))
+							connectedFlag <- 0
+							return
+						}
+						event, err := ParseRabbitEvent(d.RoutingKey, d.Body)
+						if err != nil {
+							dispatcher.Status(fmt.Sprintf("rabbitmq message error: %s", err))
+						} else if event != nil {
+							dispatcher.Dispatch(event)
+						}
+					}
+				}(key)
+			}
+
+			// Wait for someone to notify us about a broken channel
+			if reconnects == 0 {
+				dispatcher.Status("RabbitMQ mode")
+			} else if reconnects == 1 {
+				dispatcher.Status("RabbitMQ mode (reconnected)")
+			} else {
+				dispatcher.Status(fmt.Sprintf("RabbitMQ mode (%dx reconnected)", reconnects))
+			}
+			<-connectedFlag
+			rmq.Close() // Close for everyone and wait a bit before reconnecting
+			reconnects++
+			metrics.Add("openqa_mon_rabbitmq_reconnects_total", 1, "remote", openqaURI)
+			dispatcher.Status(fmt.Sprintf("RabbitMQ reconnecting %d ...", reconnects))
+			time.Sleep(time.Duration(2) * time.Second)
+			// Consume remaining signals
+			consuming := true
+			for consuming {
+				select {
+				case <-connectedFlag:
+					consuming = true
+				default:
+					consuming = false
+				}
+			}
+			rmq.Reconnect()
+			dispatcher.Status(fmt.Sprintf("RabbitMQ reconnecting %d ...", reconnects))
+			refresh()
+		}
+	}
+	go recvFunction(&rmq)
+	return rmq, nil
+}
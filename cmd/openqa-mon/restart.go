@@ -0,0 +1,185 @@
+/* Automatic restart of incomplete jobs (--auto-restart) */
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+var restarter = CreateAutoRestarter(0, false)
+
+// AutoRestarter restarts incomplete (and optionally failed) jobs up to a maximum number of times per original job and keeps track of the retry chains
+type AutoRestarter struct {
+	Max    int  // Maximum number of restarts per original job (0 = disabled)
+	Failed bool // Also restart failed jobs
+
+	// Restart the given job and return the ID of the clone
+	Restart func(job gopenqa.Job) (int64, error)
+
+	chains   map[jobKey][]int64 // Retry chain of the original jobs, starting with the original job
+	origin   map[jobKey]int64   // Original job of every job in a retry chain
+	failures map[jobKey]int     // Number of failed restart attempts of the original jobs
+	mutex    sync.Mutex
+}
+
+// CreateAutoRestarter creates a restarter, which restarts jobs via the openQA API
+func CreateAutoRestarter(retries int, failed bool) *AutoRestarter {
+	restarter := AutoRestarter{Max: retries, Failed: failed}
+	restarter.chains = make(map[jobKey][]int64, 0)
+	restarter.origin = make(map[jobKey]int64, 0)
+	restarter.failures = make(map[jobKey]int, 0)
+	restarter.Restart = func(job gopenqa.Job) (int64, error) {
+		clone, err := RestartJob(job)
+		if err != nil || clone != 0 {
+			return clone, err
+		}
+		// Older openQA versions don't return the clone, so it needs to be looked up
+		job, err = instances.Get(job.Remote).GetJob(job.ID)
+		if err != nil {
+			return 0, err
+		}
+		if !job.IsCloned() {
+			return 0, fmt.Errorf("clone of job %d not found", job.ID)
+		}
+		return job.CloneID, nil
+	}
+	return &restarter
+}
+
+// Enabled returns true if jobs are restarted automatically
+func (r *AutoRestarter) Enabled() bool {
+	return r.Max > 0
+}
+
+// Returns the original job of the given job
+func (r *AutoRestarter) original(job gopenqa.Job) jobKey {
+	if id, ok := r.origin[jobKey{Remote: job.Remote, ID: job.ID}]; ok {
+		return jobKey{Remote: job.Remote, ID: id}
+	}
+	return jobKey{Remote: job.Remote, ID: job.ID}
+}
+
+// Wants returns true if the given job qualifies for a restart
+func (r *AutoRestarter) Wants(job gopenqa.Job) bool {
+	if !r.Enabled() || job.State != "done" || job.IsCloned() {
+		return false
+	}
+	if job.Result != "incomplete" && (!r.Failed || job.Result != "failed") {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// Failed restart attempts count as well, so that a job that cannot be restarted is not retried forever
+	original := r.original(job)
+	return r.retries(original)+r.failures[original] < r.Max
+}
+
+// Returns the number of restarts of the given original job
+func (r *AutoRestarter) retries(original jobKey) int {
+	return max(0, len(r.chains[original])-1)
+}
+
+// Chain returns the retry chain of the given job, starting with the original job. Returns nil if the job has not been restarted
+func (r *AutoRestarter) Chain(job gopenqa.Job) []int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.chains[r.original(job)]
+}
+
+// Retries returns the number of restarts of the original job of the given job
+func (r *AutoRestarter) Retries(job gopenqa.Job) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.retries(r.original(job))
+}
+
+// Check restarts the given job if it qualifies for a restart. Returns the clone and true, if the job has been restarted
+func (r *AutoRestarter) Check(job gopenqa.Job) (gopenqa.Job, bool, error) {
+	if !r.Wants(job) {
+		return job, false, nil
+	}
+	id, err := r.Restart(job)
+	r.mutex.Lock()
+	original := r.original(job)
+	if err != nil {
+		r.failures[original]++
+		r.mutex.Unlock()
+		return job, false, err
+	}
+	if len(r.chains[original]) == 0 {
+		r.chains[original] = []int64{original.ID}
+	}
+	r.chains[original] = append(r.chains[original], id)
+	r.origin[jobKey{Remote: job.Remote, ID: id}] = original.ID
+	r.mutex.Unlock()
+
+	// The next refresh fetches the clone
+	return scheduledClone(job, id), true, nil
+}
+
+// scheduledClone returns the clone with the given ID of the given job, as a copy of the job that has not started yet
+func scheduledClone(job gopenqa.Job, id int64) gopenqa.Job {
+	clone := job
+	clone.ID = id
+	clone.CloneID = 0
+	clone.State = "scheduled"
+	clone.Result = "none"
+	clone.Tstarted = ""
+	clone.Tfinished = ""
+	clone.AssignedWorkerID = 0
+	clone.Link = fmt.Sprintf("%s/tests/%d", job.Remote, id)
+	return clone
+}
+
+// Format the retry chain of the given job, e.g. "123 -> 124 -> 125"
+func formatChain(chain []int64) string {
+	ids := make([]string, 0)
+	for _, id := range chain {
+		ids = append(ids, fmt.Sprintf("%d", id))
+	}
+	return strings.Join(ids, " -> ")
+}
+
+// Restart the jobs that qualify for an automatic restart. Restarted jobs are replaced by their clones, also in the remotes, so that the clones are monitored from now on
+// transition is called for every restarted job with the job and its clone
+func autoRestartJobs(remotes []Remote, jobs []gopenqa.Job, transition func(old, job gopenqa.Job, id int64)) ([]Remote, []gopenqa.Job, error) {
+	var ret error
+	for i, job := range jobs {
+		clone, restarted, err := restarter.Check(job)
+		if err != nil {
+			ret = fmt.Errorf("error restarting job %d: %s", job.ID, err)
+			continue
+		}
+		if !restarted {
+			continue
+		}
+		for j, remote := range remotes {
+			if ensureHTTP(homogenizeRemote(remote.URI)) == job.Remote {
+				for k, id := range remote.Jobs {
+					if id == job.ID {
+						remotes[j].Jobs[k] = clone.ID
+					}
+				}
+			}
+		}
+		jobs[i] = clone
+		transition(job, clone, job.ID)
+	}
+	return remotes, jobs, ret
+}
+
+// Print the given failed jobs and their retry chains
+func reportFailedJobs(failed []gopenqa.Job) {
+	fmt.Fprintf(os.Stderr, "%d job(s) completed with errors\n", len(failed))
+	for _, job := range failed {
+		if chain := restarter.Chain(job); len(chain) > 1 {
+			fmt.Fprintf(os.Stderr, "%s (retries: %s)\n", job.String(), formatChain(chain))
+		} else {
+			fmt.Fprintf(os.Stderr, "%s\n", job.String())
+		}
+	}
+}
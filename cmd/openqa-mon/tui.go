@@ -2,6 +2,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/os-autoinst/gopenqa"
@@ -26,6 +28,9 @@ const ANSI_MAGENTA = "\u001b[35m"
 const ANSI_CYAN = "\u001b[36m"
 const ANSI_WHITE = "\u001b[37m"
 const ANSI_RESET = "\u001b[0m"
+const ANSI_REVERSE = "\u001b[7m"
+const ANSI_ALERT = "\u001b[1;4m" // bold and underlined
+const ANSI_STALE = "\u001b[2m"   // faint
 
 const ANSI_ALT_SCREEN = "\x1b[?1049h"
 const ANSI_EXIT_ALT_SCREEN = "\x1b[?1049l"
@@ -47,13 +52,21 @@ type TUI struct {
 	hideEnable  bool   // If hideStates will be considered
 	currentPage int    // the page we are displaying (0=first)
 	totalPages  int    // how many pages are there to display
+	pageHeight  int    // number of jobs per page
+	cursor      int    // index of the selected job in Model.jobs, used as fallback if the selected job is gone
+	selected    jobKey // the selected job
+	showDetails bool   // Show details of the selected job instead of the job list
 }
 
 /* The model that will be displayed in the TUI */
 type TUIModel struct {
-	jobs       []gopenqa.Job // Jobs to be displayed
-	HideStates []string      // Jobs with this status will be hidden
-	mutex      sync.Mutex    // Access mutex to the model
+	jobs       []gopenqa.Job   // Jobs to be displayed
+	HideStates []string        // Jobs with this status will be hidden
+	dropped    map[jobKey]bool // Jobs that have been removed from the watch list
+	refreshes  int             // Number of started refreshes
+	updated    map[jobKey]int  // Refresh in which the jobs have been updated the last time
+	added      []gopenqa.Job   // Jobs that have been added to the watch list since the last call of TakeAdded
+	mutex      sync.Mutex      // Access mutex to the model
 }
 
 type winsize struct {
@@ -103,51 +116,93 @@ func CreateTUI() *TUI {
 	tui.hideEnable = true
 	tui.currentPage = 0
 	tui.totalPages = 1
+	tui.pageHeight = 1
+	tui.Model.dropped = make(map[jobKey]bool, 0)
+	tui.Model.updated = make(map[jobKey]int, 0)
 	return &tui
 }
 
+// openBrowser opens the given link in the default browser
+func openBrowser(link string) error {
+	return exec.Command("xdg-open", link).Start()
+}
+
+// copyToClipboard copies the given text to the clipboard. Falls back to the OSC 52 terminal sequence, if no clipboard utility is available
+func copyToClipboard(text string) error {
+	utilities := [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	for _, utility := range utilities {
+		if _, err := exec.LookPath(utility[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(utility[0], utility[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	fmt.Printf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return nil
+}
+
 func bell() {
 	// Use system bell
 	fmt.Print("\a")
 }
 
-func notifySend(text string) {
-	cmd := exec.Command("notify-send", text)
-	err := cmd.Run()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error sending notification via 'notify-send': %s\n", err)
+// notify sends the given notification via the given notification backends. No backends means all configured backends
+func notify(notification internal.Notification, backends []string) {
+	if err := notifiers.Select(backends).Notify(notification); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending notification: %s\n", err)
+	}
+}
+
+// jobColor returns the ANSI color code for the current state of the given job
+func jobColor(job gopenqa.Job) string {
+	if job.State == "running" {
+		return ANSI_BLUE
+	} else if job.State == "done" {
+		switch job.Result {
+		case "failed", "incomplete":
+			return ANSI_RED
+		case "cancelled", "user_cancelled":
+			return ANSI_MAGENTA
+		case "passed":
+			return ANSI_GREEN
+		case "user_restarted", "parallel_restarted":
+			return ANSI_BLUE
+		case "softfailed":
+			return ANSI_YELLOW
+		default:
+			return ANSI_WHITE
+		}
+	} else if job.State == "cancelled" {
+		return ANSI_MAGENTA
 	}
+	return ANSI_CYAN
 }
 
 // Println prints the current job in a 80 character wide line with optional colors enabled
 func PrintJob(job gopenqa.Job, useColors bool, width int) {
+	// User-defined format takes precedence over the default layout
+	if jobFormat != nil {
+		line, err := jobFormat.Format(job, useColors)
+		if err != nil {
+			line = fmt.Sprintf("%8d  format error: %s", job.ID, err)
+		}
+		fmt.Println(line)
+		if useColors {
+			fmt.Print(ANSI_RESET)
+		}
+		return
+	}
+
 	status := job.JobState()
+	if job.State == "scheduled" {
+		status = fmt.Sprintf("scheduled (p=%d)", job.Priority)
+	}
+	stale := RemoteError(job)
 	if useColors {
-		if job.State == "running" {
-			fmt.Print(ANSI_BLUE)
-		} else if job.State == "done" {
-			status = job.Result
-			switch job.Result {
-			case "failed", "incomplete":
-				fmt.Print(ANSI_RED)
-			case "cancelled", "user_cancelled":
-				fmt.Print(ANSI_MAGENTA)
-			case "passed":
-				fmt.Print(ANSI_GREEN)
-			case "user_restarted", "parallel_restarted":
-				fmt.Print(ANSI_BLUE)
-			case "softfailed":
-				fmt.Print(ANSI_YELLOW)
-			default:
-				fmt.Print(ANSI_WHITE)
-			}
-		} else if job.State == "cancelled" {
-			fmt.Print(ANSI_MAGENTA)
-		} else if job.State == "scheduled" {
-			fmt.Print(ANSI_CYAN)
-			status = fmt.Sprintf("scheduled (p=%d)", job.Priority)
-		} else {
-			fmt.Print(ANSI_CYAN)
+		fmt.Print(jobColor(job))
+		if stale != nil {
+			fmt.Print(ANSI_STALE)
 		}
 	}
 
@@ -162,6 +217,27 @@ func PrintJob(job gopenqa.Job, useColors bool, width int) {
 		name += " "
 	}
 	name += job.Test + "@" + job.Settings.Machine
+	if progress, ok := CachedJobProgress(job); ok {
+		name += " " + progress.String()
+	}
+	if timing := JobTiming(job, time.Now()); timing != "" {
+		name += " (" + timing + ")"
+	}
+	if refs := JobBugrefs(job); len(refs) > 0 {
+		name += " [" + strings.Join(refs, ", ") + "]"
+	}
+	if retries := restarter.Retries(job); retries > 0 {
+		name += fmt.Sprintf(" [retry %d/%d]", retries, restarter.Max)
+	}
+	if stale != nil {
+		name += " [stale: " + stale.Error() + "]"
+	}
+	// Mark jobs with outdated data in the TUI
+	if tui != nil && config.AgeMarker > 0 {
+		if age := tui.Model.Age(job); age >= config.AgeMarker {
+			name += fmt.Sprintf(" [%d refreshes old]", age)
+		}
+	}
 	link := job.Link
 
 	// Is there space for the link (including 2 additional spaces between name and link)?
@@ -199,6 +275,120 @@ func (m *TUIModel) SetJobs(jobs []gopenqa.Job) {
 	m.jobs = uniqueJobs(jobs)
 }
 
+// Job returns the job with the given id on the given remote and true, or false if not present
+func (m *TUIModel) Job(id int64, remote string) (gopenqa.Job, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, job := range m.jobs {
+		if job.ID == id && job.Remote == remote {
+			return job, true
+		}
+	}
+	return gopenqa.Job{}, false
+}
+
+// Jobs returns a copy of the current jobs
+func (m *TUIModel) Jobs() []gopenqa.Job {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	jobs := make([]gopenqa.Job, len(m.jobs))
+	copy(jobs, m.jobs)
+	return jobs
+}
+
+// Update applies f to the job with the given id on the given remote. Returns the job before and after the update and true, or false if not present
+func (m *TUIModel) Update(id int64, remote string, f func(job *gopenqa.Job)) (gopenqa.Job, gopenqa.Job, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.jobs {
+		if m.jobs[i].ID == id && m.jobs[i].Remote == remote {
+			old := m.jobs[i]
+			f(&m.jobs[i])
+			return old, m.jobs[i], true
+		}
+	}
+	return gopenqa.Job{}, gopenqa.Job{}, false
+}
+
+// Replace replaces the job with the given id on the given remote by job, e.g. by its clone
+func (m *TUIModel) Replace(id int64, remote string, job gopenqa.Job) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.jobs {
+		if m.jobs[i].ID == id && m.jobs[i].Remote == remote {
+			m.jobs[i] = job
+		}
+	}
+	m.jobs = uniqueJobs(m.jobs)
+}
+
+// Add adds the given job to the watch list. Returns false if the job is already present or has been dropped
+func (m *TUIModel) Add(job gopenqa.Job) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.dropped[jobKey{Remote: job.Remote, ID: job.ID}] {
+		return false
+	}
+	for _, j := range m.jobs {
+		if j.ID == job.ID && j.Remote == job.Remote {
+			return false
+		}
+	}
+	m.jobs = append(m.jobs, job)
+	m.added = append(m.added, job)
+	return true
+}
+
+// TakeAdded returns the jobs that have been added since the last call and need to be added to the monitored remotes
+func (m *TUIModel) TakeAdded() []gopenqa.Job {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	added := m.added
+	m.added = nil
+	return added
+}
+
+// Drop removes the given job from the model and marks it as dropped, i.e. it should not be monitored anymore
+func (m *TUIModel) Drop(job gopenqa.Job) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.dropped[jobKey{Remote: job.Remote, ID: job.ID}] = true
+	m.jobs = filterJobs(m.jobs, func(j gopenqa.Job) bool {
+		return j.ID != job.ID || j.Remote != job.Remote
+	})
+}
+
+// Refresh marks the start of a new refresh. Jobs that are not updated in this refresh get older
+func (m *TUIModel) Refresh() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.refreshes++
+}
+
+// Touch marks the given job as updated in the current refresh
+func (m *TUIModel) Touch(job gopenqa.Job) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.updated[jobKey{Remote: job.Remote, ID: job.ID}] = m.refreshes
+}
+
+// Age returns the number of refreshes since the given job has been updated the last time
+func (m *TUIModel) Age(job gopenqa.Job) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if updated, ok := m.updated[jobKey{Remote: job.Remote, ID: job.ID}]; ok {
+		return m.refreshes - updated
+	}
+	return 0
+}
+
+// IsDropped returns true if the job with the given id on the given remote has been dropped from the watch list
+func (m *TUIModel) IsDropped(id int64, remote string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.dropped[jobKey{Remote: remote, ID: id}]
+}
+
 func (tui *TUI) Start() {
 	// disable input buffering, if tty
 	if terminal.IsTerminal(int(os.Stdin.Fd())) {
@@ -309,10 +499,161 @@ func (tui *TUI) PrevPage() {
 	tui.UpdateHeader()
 }
 
+// NavigationKey handles the last byte of the escape sequence of a navigation key (arrows, home, end, page up and down)
+func (tui *TUI) NavigationKey(key byte) {
+	switch key {
+	case 65: // arrow up
+		tui.CursorUp()
+	case 66: // arrow down
+		tui.CursorDown()
+	case 72: // home
+		tui.FirstPage()
+	case 70: // end
+		tui.LastPage()
+	case 53: // page up
+		tui.PrevPage()
+	case 54: // page down
+		tui.NextPage()
+	case 68: // arrow left
+		tui.PrevPage()
+	case 67: // arrow right
+		tui.NextPage()
+	}
+}
+
 func (tui *TUI) DoHideStates() bool {
 	return tui.hideEnable
 }
 
+// Returns the index of the selected job in the given jobs and true. If the selected job is gone, the job at the last cursor position is selected and false is returned
+// Returns -1 if there are no jobs. The caller must hold the model mutex
+func (tui *TUI) selectedIndex(jobs []gopenqa.Job) (int, bool) {
+	for i, job := range jobs {
+		if (jobKey{Remote: job.Remote, ID: job.ID}) == tui.selected {
+			tui.cursor = i
+			return i, true
+		}
+	}
+	if len(jobs) == 0 {
+		return -1, false
+	}
+	tui.cursor = max(0, min(tui.cursor, len(jobs)-1))
+	tui.selected = jobKey{Remote: jobs[tui.cursor].Remote, ID: jobs[tui.cursor].ID}
+	return tui.cursor, false
+}
+
+// Move the cursor by the given number of visible jobs and switch to the page of the selected job
+func (tui *TUI) moveCursor(direction int) {
+	tui.Model.mutex.Lock()
+	defer tui.Model.mutex.Unlock()
+	jobs := tui.Model.jobs
+	cursor, _ := tui.selectedIndex(jobs)
+	for i := cursor + direction; i >= 0 && i < len(jobs); i += direction {
+		if !(tui.hideEnable && tui.doHideJob(jobs[i])) {
+			tui.cursor = i
+			tui.selected = jobKey{Remote: jobs[i].Remote, ID: jobs[i].ID}
+			break
+		}
+	}
+	tui.currentPage = tui.cursor / max(1, tui.pageHeight)
+	tui.UpdateHeader()
+}
+
+func (tui *TUI) CursorUp() {
+	tui.moveCursor(-1)
+}
+
+func (tui *TUI) CursorDown() {
+	tui.moveCursor(1)
+}
+
+// SelectedJob returns the job under the cursor and true, or false if no job is selected
+func (tui *TUI) SelectedJob() (gopenqa.Job, bool) {
+	tui.Model.mutex.Lock()
+	defer tui.Model.mutex.Unlock()
+	cursor, _ := tui.selectedIndex(tui.Model.jobs)
+	if cursor < 0 {
+		return gopenqa.Job{}, false
+	}
+	return tui.Model.jobs[cursor], true
+}
+
+func (tui *TUI) SetShowDetails(enabled bool) {
+	tui.Model.mutex.Lock()
+	defer tui.Model.mutex.Unlock()
+	tui.showDetails = enabled
+}
+
+func (tui *TUI) DoShowDetails() bool {
+	return tui.showDetails
+}
+
+// Format the details of the given job as individual lines
+func jobDetails(job gopenqa.Job) []string {
+	lines := make([]string, 0)
+	lines = append(lines, fmt.Sprintf("Job %d - %s", job.ID, job.Name))
+	lines = append(lines, "")
+	lines = append(lines, fmt.Sprintf("  Test:      %s", job.Test))
+	lines = append(lines, fmt.Sprintf("  Machine:   %s (%s, %s)", job.Settings.Machine, job.Settings.Arch, job.Settings.Backend))
+	lines = append(lines, fmt.Sprintf("  State:     %s", job.State))
+	if job.Result != "" {
+		lines = append(lines, fmt.Sprintf("  Result:    %s", job.Result))
+	}
+	if progress, ok := CachedJobProgress(job); ok {
+		lines = append(lines, fmt.Sprintf("  Module:    %s (%d passed, %d failed, %d total)", progress.Current, progress.Passed, progress.Failed, progress.Total))
+	}
+	now := time.Now()
+	if elapsed, ok := JobElapsed(job, now); ok {
+		lines = append(lines, fmt.Sprintf("  Elapsed:   %s %s", job.State, formatDuration(elapsed)))
+	}
+	if remaining, ok := JobRemaining(job, now); ok {
+		duration, _ := CachedScenarioDuration(job)
+		if remaining < 0 {
+			lines = append(lines, fmt.Sprintf("  ETA:       overdue by %s (usually %s)", formatDuration(-remaining), formatDuration(duration)))
+		} else {
+			lines = append(lines, fmt.Sprintf("  ETA:       %s (usually %s)", formatDuration(remaining), formatDuration(duration)))
+		}
+	}
+	if reason, ok := alerts.Alerted(job); ok {
+		lines = append(lines, fmt.Sprintf("  Alert:     %s", reason))
+	}
+	if refs := JobBugrefs(job); len(refs) > 0 {
+		lines = append(lines, fmt.Sprintf("  Bugrefs:   %s", strings.Join(refs, ", ")))
+	}
+	if err := RemoteError(job); err != nil {
+		lines = append(lines, fmt.Sprintf("  Stale:     %s", err))
+	}
+	lines = append(lines, fmt.Sprintf("  Priority:  %d", job.Priority))
+	if job.Tstarted != "" {
+		lines = append(lines, fmt.Sprintf("  Started:   %s", job.Tstarted))
+	}
+	if job.Tfinished != "" {
+		lines = append(lines, fmt.Sprintf("  Finished:  %s", job.Tfinished))
+	}
+	if job.AssignedWorkerID != 0 {
+		lines = append(lines, fmt.Sprintf("  Worker:    %d", job.AssignedWorkerID))
+	}
+	if job.GroupID != 0 {
+		lines = append(lines, fmt.Sprintf("  Group:     %d", job.GroupID))
+	}
+	if job.IsCloned() {
+		lines = append(lines, fmt.Sprintf("  Clone:     %d", job.CloneID))
+	}
+	if chain := restarter.Chain(job); len(chain) > 1 {
+		lines = append(lines, fmt.Sprintf("  Retries:   %s", formatChain(chain)))
+	}
+	children := len(job.Children.Chained) + len(job.Children.DirectlyChained) + len(job.Children.Parallel)
+	parents := len(job.Parents.Chained) + len(job.Parents.DirectlyChained) + len(job.Parents.Parallel)
+	if children > 0 || parents > 0 {
+		lines = append(lines, fmt.Sprintf("  Children:  %d, Parents: %d", children, parents))
+	}
+	lines = append(lines, fmt.Sprintf("  Remote:    %s", job.Remote))
+	lines = append(lines, fmt.Sprintf("  Link:      %s", job.Link))
+	lines = append(lines, "")
+	lines = append(lines, "Press any key to return")
+	return lines
+}
+
 // Read keys
 func (tui *TUI) readInput() {
 	var b []byte = make([]byte, 1)
@@ -339,9 +680,24 @@ func (tui *TUI) doHideJob(j gopenqa.Job) bool {
 	return false
 }
 
+// Returns a copy of the jobs to be displayed, the index of the selected job and if the details of the selected job are shown
+// Works on a copy, because the model is updated concurrently by refreshes and RabbitMQ events. The details are closed if the selected job is gone
+func (tui *TUI) snapshot() ([]gopenqa.Job, int, bool) {
+	tui.Model.mutex.Lock()
+	defer tui.Model.mutex.Unlock()
+	jobs := make([]gopenqa.Job, len(tui.Model.jobs))
+	copy(jobs, tui.Model.jobs)
+	cursor, found := tui.selectedIndex(jobs)
+	if !found {
+		tui.showDetails = false
+	}
+	return jobs, cursor, tui.showDetails
+}
+
 // Redraw tui
 func (tui *TUI) Update() {
-	if len(tui.Model.jobs) == 0 {
+	jobs, cursor, showDetails := tui.snapshot()
+	if len(jobs) == 0 {
 		// no jobs fetched yet, nothing to display
 		return
 	}
@@ -354,7 +710,7 @@ func (tui *TUI) Update() {
 		lines++
 	}
 	if tui.showHelp {
-		help := "?:Toggle help  r:Refresh  d:Toggle notifications  b:Toggle bell  +/-:Modify refresh time  p:Toggle pause  <>:Page"
+		help := "?:Toggle help  r:Refresh  d:Toggle notifications  b:Toggle bell  +/-:Modify refresh time  p:Toggle pause  <>:Page  j/k:Select  o:Open  y:Copy link  i:Details  x:Drop  R:Restart  C:Cancel  F:Restart failed"
 		if len(tui.Model.HideStates) > 0 {
 			help += "  h:Toggle hide"
 		}
@@ -366,19 +722,35 @@ func (tui *TUI) Update() {
 	if tui.showStatus {
 		pageHeight--
 	}
-	// ensure to always have something to display without exceeding the slice limits
-	startIdx := min(tui.currentPage*pageHeight, len(tui.Model.jobs))
-	endIdx := min(startIdx+pageHeight, len(tui.Model.jobs))
-	tui.totalPages = len(tui.Model.jobs) / pageHeight
-	if len(tui.Model.jobs)%pageHeight > 0 {
-		tui.totalPages++ // one more page for any partial-page leftover
-	}
-	for _, job := range tui.Model.jobs[startIdx:endIdx] {
-		if tui.hideEnable && tui.doHideJob(job) {
-			continue
+	tui.pageHeight = max(1, pageHeight)
+	if showDetails {
+		for _, line := range jobDetails(jobs[cursor]) {
+			PrintLine(line, width)
+			lines++
+		}
+	} else {
+		// ensure to always have something to display without exceeding the slice limits
+		startIdx := min(tui.currentPage*pageHeight, len(jobs))
+		endIdx := min(startIdx+pageHeight, len(jobs))
+		tui.totalPages = len(jobs) / pageHeight
+		if len(jobs)%pageHeight > 0 {
+			tui.totalPages++ // one more page for any partial-page leftover
+		}
+		for i, job := range jobs[startIdx:endIdx] {
+			if tui.hideEnable && tui.doHideJob(job) {
+				continue
+			}
+			// Highlight the selected job
+			if startIdx+i == cursor {
+				fmt.Print(ANSI_REVERSE)
+			}
+			// Highlight stuck jobs
+			if _, ok := alerts.Alerted(job); ok {
+				fmt.Print(ANSI_ALERT)
+			}
+			PrintJob(job, true, width)
+			lines++
 		}
-		PrintJob(job, true, width)
-		lines++
 	}
 
 	// print some empty lines if needed to fill last page and make footer always on last line
@@ -2,9 +2,11 @@
 package main
 
 import (
+	"fmt"
 	"os/user"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/os-autoinst/gopenqa"
 )
@@ -34,6 +36,21 @@ func homogenizeRemote(remote string) string {
 	return remote
 }
 
+// Parse a openQA timestamp. openQA timestamps are in UTC
+func parseTimestamp(timestamp string) (time.Time, error) {
+	return time.Parse("2006-01-02T15:04:05", timestamp)
+}
+
+// Format the given duration in a short human readable form, e.g. "45s", "12m" or "1h02m"
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	} else if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
 func max(x int, y int) int {
 	if x > y {
 		return x
@@ -61,6 +78,17 @@ func trimSplit(s string, sep string) []string {
 	return split
 }
 
+// Remove empty entries from a string slice
+func filterEmpty(s []string) []string {
+	ret := make([]string, 0)
+	for _, t := range s {
+		if strings.TrimSpace(t) != "" {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
 func homeDir() string {
 	usr, err := user.Current()
 	if err != nil {
@@ -144,6 +172,17 @@ func filterJobs(jobs []gopenqa.Job, f func(job gopenqa.Job) bool) []gopenqa.Job
 	return jobs[:i]
 }
 
+// Filter a job ID slice based on a function
+func filterIDs(ids []int64, f func(id int64) bool) []int64 {
+	ret := make([]int64, 0)
+	for _, id := range ids {
+		if f(id) {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
 func findJob(jobs []gopenqa.Job, id int64) (gopenqa.Job, bool) {
 	for _, job := range jobs {
 		if job.ID == id {
@@ -0,0 +1,177 @@
+/* Blocking wait for jobs without TUI, e.g. for scripts */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// Print the given transition as plain line or as json line
+func printEvent(out io.Writer, event Event, output string) {
+	if output == "json" || output == "ndjson" {
+		if buf, err := json.Marshal(event); err == nil {
+			fmt.Fprintln(out, string(buf))
+		}
+		return
+	}
+	fmt.Fprintln(out, FormatEvent(event))
+}
+
+// FormatEvent formats the given transition as plain line
+func FormatEvent(event Event) string {
+	state := func(state, result string) string {
+		if state == "done" {
+			return result
+		}
+		return state
+	}
+	line := fmt.Sprintf("%s %s/tests/%d ", event.Timestamp, event.Remote, event.ID)
+	if event.OldState != "" {
+		line += state(event.OldState, event.OldResult) + " -> "
+	}
+	line += state(event.NewState, event.NewResult)
+	if event.PreviousID != 0 {
+		line += fmt.Sprintf(" (clone of %d)", event.PreviousID)
+	}
+	return line
+}
+
+// Parse a timeout as go duration (e.g. 90m) or as number of seconds
+func parseTimeout(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Wait until all jobs of the given remotes are done and print their transitions. Returns the exit code
+func waitForJobs(remotes []Remote, out io.Writer) int {
+	waiter := CreateTUI() // Only the model is used, nothing is displayed
+	model := &waiter.Model
+
+	// Signal for a refresh
+	refreshSignal := make(chan int, 1)
+	refresh := func() {
+		select {
+		case refreshSignal <- 1:
+		default:
+		}
+	}
+	// Signal for updates via RabbitMQ
+	updated := make(chan int, 1)
+
+	transition := func(old, job gopenqa.Job, id int64, source string) {
+		logTransition(old, job, id, source)
+		if IsTransition(old, job) {
+			printEvent(out, CreateEvent(old, job, id, source, time.Now()), config.Output)
+		}
+	}
+
+	config.Hybrid = false
+	if config.RabbitMQ {
+		connections, complete := connectRabbitMQs(remotes, func(openqaURI string, remote string, keys []string) (gopenqa.RabbitMQ, error) {
+			dispatcher := CreateRabbitDispatcher(openqaURI, model)
+			dispatcher.Status = func(status string) {}
+			dispatcher.Updated = func(old, job gopenqa.Job, id int64) {
+				transition(old, job, id, "rabbitmq")
+				select {
+				case updated <- 1:
+				default:
+				}
+			}
+			return subscribeRabbitMQ(dispatcher, openqaURI, remote, keys, refresh)
+		})
+		for _, rabbitmq := range connections {
+			defer rabbitmq.Close()
+		}
+		// Polling is still required to notice started jobs, but at the reconciliation interval
+		config.Hybrid = complete
+	}
+
+	var timeout <-chan time.Time
+	if config.Timeout > 0 {
+		timeout = time.After(config.Timeout)
+	}
+	poll := true
+	var next <-chan time.Time // Next regular poll
+	for {
+		if poll {
+			next = time.After(time.Duration(pollInterval()) * time.Second)
+			source := "poll"
+			if config.Hybrid {
+				source = "reconcile"
+			}
+			for _, job := range model.TakeAdded() {
+				remotes = appendJobRemote(remotes, job)
+			}
+			jobs := make([]gopenqa.Job, 0)
+			var err error
+			remotes, err = FetchJobs(remotes, func(id int64, job gopenqa.Job) {
+				old, found := model.Job(id, job.Remote)
+				if !found {
+					// The job might have been replaced by its clone via RabbitMQ already
+					old, _ = model.Job(job.ID, job.Remote)
+				}
+				transition(old, job, id, source)
+				jobs = append(jobs, job)
+			})
+			// Jobs of remotes that could not be fetched are kept
+			errs := AsFetchErrors(err)
+			for _, job := range model.Jobs() {
+				if errs[job.Remote] != nil {
+					jobs = append(jobs, job)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching jobs: %s\n", err)
+			}
+			model.SetJobs(jobs)
+		}
+		jobs := model.Jobs()
+		// Restart before deciding if we are done, also for jobs that have been updated via RabbitMQ
+		if restarter.Enabled() {
+			var err error
+			remotes, jobs, err = autoRestartJobs(remotes, jobs, func(old, job gopenqa.Job, id int64) {
+				transition(old, job, id, "restart")
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+			model.SetJobs(jobs)
+		}
+		PruneCaches(jobs)
+		if len(jobs) > 0 && jobsDone(jobs) {
+			if config.JUnitFile != "" {
+				if err := WriteJUnitReport(config.JUnitFile, jobs); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing JUnit report: %s\n", err)
+				}
+			}
+			if failed := getFailedJobs(jobs); len(failed) > 0 {
+				reportFailedJobs(failed)
+			}
+			return config.Exit.ExitCode(jobs)
+		}
+
+		select {
+		case <-refreshSignal:
+			poll = true
+		case <-updated:
+			poll = false
+		case <-next:
+			poll = true
+		case <-timeout:
+			pending := filterJobs(jobs, func(job gopenqa.Job) bool { return job.State != "done" && job.State != "cancelled" })
+			fmt.Fprintf(os.Stderr, "Timeout: %d job(s) not done\n", len(pending))
+			for _, job := range pending {
+				fmt.Fprintf(os.Stderr, "%s\n", job.String())
+			}
+			return config.Exit.Timeout
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/os-autoinst/openqa-mon/internal"
 )
 
 /* Group is a single configurable monitoring unit. A group contains all parameters that will be queried from openQA */
@@ -17,28 +18,42 @@ type Group struct {
 
 /* Program configuration parameters */
 type Config struct {
-	Name            string            // Configuration name, if set
-	Instance        string            // Instance URL to be used
-	RabbitMQ        string            // RabbitMQ url to be used
-	RabbitMQTopic   string            // Topic to subscribe to
-	DefaultParams   map[string]string // Default parameters
-	HideStatus      []string          // Hide jobs that carry this status
-	Notify          bool              // Send system notification on job changes
-	RefreshInterval int64             // Periodic refresh delay in seconds
-	Groups          []Group           // Groups that will be monitord
-	MaxJobs         int               // Maximum number of jobs per group to consider
-	GroupBy         string            // Display group mode: "none", "groups"
-	RequestJobLimit int               // Maximum number of jobs in a single request
+	Name               string                      // Configuration name, if set
+	Instance           string                      // Instance URL to be used
+	RabbitMQ           string                      // RabbitMQ url to be used
+	RabbitMQTopic      string                      // Topic to subscribe to
+	DefaultParams      map[string]string           // Default parameters
+	HideStatus         []string                    // Hide jobs that carry this status
+	Notify             bool                        // Send system notification on job changes
+	RefreshInterval    int64                       // Periodic refresh delay in seconds
+	Groups             []Group                     // Groups that will be monitord
+	MaxJobs            int                         // Maximum number of jobs per group to consider
+	GroupBy            string                      // Display group mode: "none", "groups"
+	RequestJobLimit    int                         // Maximum number of jobs in a single request
+	Notifiers          internal.NotifierConfig     // Notification backends
+	NotificationRules  []internal.NotificationRule // Rules which jobs to notify about and via which backends
+	NotifyWindow       int64                       // Coalesce notifications within this number of seconds into a summary (0 = per refresh)
+	NotifyMaxPerMinute int                         // Maximum number of notifications per minute (0 = unlimited)
+	Retries            int                         // Maximum number of retries of failed requests (0 = disabled)
+	RetryDelay         float64                     // Delay before the first retry in seconds, doubled on every retry
+	AgeMarker          int                         // Mark jobs which have not been updated for this number of refreshes (0 = disabled)
 }
 
 func (cf Config) Validate() error {
 	if len(cf.Groups) == 0 {
 		return fmt.Errorf("no review groups defined")
 	}
+	if cf.Retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", cf.Retries)
+	}
+	if cf.RetryDelay < 0 {
+		return fmt.Errorf("invalid retry delay: %g", cf.RetryDelay)
+	}
 	return nil
 }
 
 func (cf *Config) LoadToml(filename string) error {
+	cf.SetRetryDefaults()
 	if _, err := toml.DecodeFile(filename, cf); err != nil {
 		return err
 	}
@@ -81,11 +96,20 @@ func CreateConfig() Config {
 	cf.Groups = make([]Group, 0)
 	cf.MaxJobs = 20
 	cf.RequestJobLimit = 100
+	cf.SetRetryDefaults()
 	return cf
 }
 
+// SetRetryDefaults sets the default retry and age marker settings, which apply if not present in the configuration file
+func (cf *Config) SetRetryDefaults() {
+	cf.Retries = 3
+	cf.RetryDelay = 1
+	cf.AgeMarker = 2
+}
+
 func LoadDefaultConfig() (Config, error) {
 	var cf Config
+	cf.SetRetryDefaults()
 	configFile := homeDir() + "/.openqa-revtui.toml"
 	if fileExists(configFile) {
 		if err := cf.LoadToml(configFile); err != nil {
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/os-autoinst/openqa-mon/internal"
+)
+
+var metrics = CreateReviewMetrics()
+var metricsListen string // Serve Prometheus metrics on this address, if set
+
+// CreateReviewMetrics creates the metrics registry with all metrics of openqa-revtui
+func CreateReviewMetrics() *internal.Metrics {
+	metrics := internal.CreateMetrics()
+	metrics.Register("openqa_revtui_jobs", "gauge", "Number of jobs by instance, job group, state and result")
+	metrics.Register("openqa_revtui_unreviewed_jobs", "gauge", "Number of failed jobs without review by instance and job group")
+	metrics.Register("openqa_revtui_last_refresh_timestamp_seconds", "gauge", "Unix timestamp of the last successful refresh by instance")
+	metrics.Register("openqa_revtui_fetch_errors_total", "counter", "Number of failed job refreshes by instance")
+	metrics.Register("openqa_revtui_rabbitmq_reconnects_total", "counter", "Number of RabbitMQ reconnects by instance")
+	return metrics
+}
+
+// UpdateJobMetrics recomputes the job metrics from the jobs of all given models
+func UpdateJobMetrics(metrics *internal.Metrics, models []TUIModel) {
+	type jobKey struct{ Instance, Group, State, Result string }
+	type groupKey struct{ Instance, Group string }
+	jobs := make(map[jobKey]int, 0)
+	unreviewed := make(map[groupKey]int, 0)
+	for i := range models {
+		model := &models[i]
+		for _, job := range model.Jobs() {
+			group := model.GroupName(job.GroupID)
+			jobs[jobKey{Instance: model.Config.Instance, Group: group, State: job.State, Result: job.Result}]++
+			state := job.JobState()
+			if (state == "failed" || state == "incomplete" || state == "parallel_failed") && !model.IsReviewed(job.ID) {
+				unreviewed[groupKey{Instance: model.Config.Instance, Group: group}]++
+			}
+		}
+	}
+	metrics.Reset("openqa_revtui_jobs")
+	for key, count := range jobs {
+		metrics.Set("openqa_revtui_jobs", float64(count), "instance", key.Instance, "group", key.Group, "state", key.State, "result", key.Result)
+	}
+	metrics.Reset("openqa_revtui_unreviewed_jobs")
+	for key, count := range unreviewed {
+		metrics.Set("openqa_revtui_unreviewed_jobs", float64(count), "instance", key.Instance, "group", key.Group)
+	}
+}
+
+// Record the outcome of a job refresh of the given model
+func refreshed(model *TUIModel, err error) {
+	if err != nil {
+		metrics.Add("openqa_revtui_fetch_errors_total", 1, "instance", model.Config.Instance)
+	} else {
+		metrics.Add("openqa_revtui_fetch_errors_total", 0, "instance", model.Config.Instance)
+		metrics.Set("openqa_revtui_last_refresh_timestamp_seconds", float64(time.Now().Unix()), "instance", model.Config.Instance)
+	}
+	UpdateJobMetrics(metrics, tui.Tabs)
+}
+
+// Serve the metrics on the given address in the background. The address is bound immediately, so that errors are returned before the TUI starts
+func serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := metrics.Serve(listener); err != nil {
+			tui.SetStatus(fmt.Sprintf("Error serving metrics: %s", err))
+		}
+	}()
+	return nil
+}
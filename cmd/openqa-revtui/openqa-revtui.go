@@ -13,6 +13,9 @@ import (
 
 var tui *TUI
 
+// Reusable openQA instances and API credentials per remote
+var instances = internal.CreateInstances("openqa-mon/revtui", 10)
+
 func parseProgramArgs(cf *Config) ([]Config, error) {
 	cfs := make([]Config, 0)
 	n := len(os.Args)
@@ -68,6 +71,11 @@ func parseProgramArgs(cf *Config) ([]Config, error) {
 				cf.Notify = true
 			case "-m", "--mute", "--silent", "--no-notify":
 				cf.Notify = false
+			case "--metrics-listen":
+				if i++; i >= n {
+					return cfs, fmt.Errorf("missing argument: %s", "metrics listen address")
+				}
+				metricsListen = os.Args[i]
 			default:
 				return cfs, fmt.Errorf("illegal argument: %s", arg)
 			}
@@ -139,6 +147,7 @@ func printUsage() {
 	fmt.Println("    -p,--param NAME=VALUE               Set a default parameter (e.g. \"distri=opensuse\")")
 	fmt.Println("    -n,--notify                         Enable notifications")
 	fmt.Println("    -m,--mute                           Disable notifications")
+	fmt.Println("    --metrics-listen ADDR               Serve Prometheus metrics on ADDR (e.g. ':9100') at /metrics")
 	fmt.Println("")
 	fmt.Println("openqa-review is part of openqa-mon (https://github.com/os-autoinst/openqa-mon/)")
 }
@@ -153,11 +162,26 @@ func registerRabbitMQ(model *TUIModel, remote, topic string) (gopenqa.RabbitMQ,
 	if err != nil {
 		return rmq, fmt.Errorf("RabbitMQ subscribe error: %s", err)
 	}
+	metrics.Add("openqa_revtui_rabbitmq_reconnects_total", 0, "instance", model.Config.Instance)
 	// Receive function
 	go func(model *TUIModel) {
 		cf := model.Config
+		// Wait longer after every failed reconnect, as the server might be down for a while
+		backoff := internal.Backoff{Delay: 2 * time.Second, MaxDelay: 5 * time.Minute}
 		for {
-			if status, err := sub.ReceiveJobStatus(); err == nil {
+			if status, err := sub.ReceiveJobStatus(); err != nil {
+				// Connection lost. Wait a bit before reconnecting
+				time.Sleep(backoff.Next())
+				if err := rmq.Reconnect(); err != nil {
+					continue
+				}
+				if sub, err = rmq.Subscribe(topic); err != nil {
+					continue
+				}
+				backoff.Reset()
+				metrics.Add("openqa_revtui_rabbitmq_reconnects_total", 1, "instance", cf.Instance)
+				tui.SetTracker(fmt.Sprintf("[%s] RabbitMQ reconnected", time.Now().Format("15:04:05")))
+			} else {
 				now := time.Now()
 				// Check if we know this job or if this is just another job.
 				job := model.Job(status.ID)
@@ -168,9 +192,11 @@ func registerRabbitMQ(model *TUIModel, remote, topic string) (gopenqa.RabbitMQ,
 				tui.SetTracker(fmt.Sprintf("[%s] Job %d-%s:%s %s", now.Format("15:04:05"), job.ID, status.Flavor, status.Build, status.Result))
 				job.State = "done"
 				job.Result = fmt.Sprintf("%s", status.Result)
+				UpdateJobMetrics(metrics, tui.Tabs)
 
 				if cf.Notify && !model.HideJob(*job) {
-					NotifySend(fmt.Sprintf("%s: %s %s", job.JobState(), job.Name, job.Test))
+					model.Notify(fmt.Sprintf("%s: %s %s", job.JobState(), job.Name, job.Test), *job)
+					model.aggregator.Done()
 				}
 			}
 		}
@@ -201,10 +227,24 @@ func main() {
 		cfs = append(cfs, defaultConfig)
 	}
 
+	// API credentials are optional, all instances work with anonymous access as well
+	if err := instances.LoadCredentials(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading API credentials: %s\n", err)
+	}
+
 	// Run terminal user interface from all available configuration objects
 	tui = CreateTUI()
 	for _, cf := range cfs {
 		model := tui.CreateTUIModel(&cf)
+		if model.notifiers, err = internal.CreateNotifiers(cf.Notifiers); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid notification configuration: %s\n", err)
+			os.Exit(1)
+		}
+		if model.rules, err = internal.CreateNotificationRules(cf.NotificationRules); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid notification rules: %s\n", err)
+			os.Exit(1)
+		}
+		model.aggregator = internal.CreateAggregator("openqa-revtui", time.Duration(cf.NotifyWindow)*time.Second, cf.NotifyMaxPerMinute, model.send)
 
 		// Apply sorting of the first group
 		switch cf.GroupBy {
@@ -218,9 +258,17 @@ func main() {
 		}
 	}
 
+	if metricsListen != "" {
+		if err := serveMetrics(metricsListen); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving metrics: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Some settings get applied from the last available configuration
 	cf := cfs[len(cfs)-1]
 	tui.SetHideStatus(cf.HideStatus)
+	internal.InstallRetryTransport(cf.Retries, time.Duration(cf.RetryDelay*float64(time.Second)))
 
 	// Enter main loop
 	err = main_loop()
@@ -245,6 +293,11 @@ func RefreshJobs() error {
 		return gopenqa.Job{}, false
 	}
 
+	// Send the notifications of this refresh, also if it fails
+	defer model.aggregator.Done()
+
+	model.StartRefresh()
+
 	// Get fresh jobs
 	status := tui.Status()
 	oldJobs := model.Jobs()
@@ -266,8 +319,10 @@ func RefreshJobs() error {
 	}
 	jobs, err := fetchJobsFollow(ids, model, callback)
 	if err != nil {
+		refreshed(model, err)
 		return err
 	}
+	model.Touch(jobs)
 	for _, job := range jobs {
 		updated := false
 		if j, found := getKnownJob(job.ID); found {
@@ -282,7 +337,7 @@ func RefreshJobs() error {
 			model.Apply(jobs)
 			tui.Update()
 			if model.Config.Notify && !model.HideJob(job) {
-				NotifySend(fmt.Sprintf("%s: %s %s", job.JobState(), job.Name, job.Test))
+				model.Notify(fmt.Sprintf("%s: %s %s", job.JobState(), job.Name, job.Test), job)
 			}
 		}
 		tui.Update()
@@ -291,6 +346,7 @@ func RefreshJobs() error {
 		if state == "failed" || state == "incomplete" || state == "parallel_failed" {
 			reviewed, err := isReviewed(job, model, state == "parallel_failed")
 			if err != nil {
+				refreshed(model, err)
 				return err
 			}
 
@@ -299,6 +355,7 @@ func RefreshJobs() error {
 		}
 	}
 	model.Apply(jobs)
+	refreshed(model, nil)
 	tui.SetStatus(status)
 	tui.Update()
 	return nil
@@ -357,6 +414,7 @@ func initialQuery() error {
 			}
 		})
 		model.Apply(jobs)
+		model.Touch(jobs)
 		fmt.Println()
 		if err != nil {
 			return fmt.Errorf("error fetching jobs: %s", err)
@@ -376,6 +434,7 @@ func initialQuery() error {
 				model.SetReviewed(job.ID, reviewed)
 			}
 		}
+		refreshed(model, nil)
 	}
 	return nil
 }
@@ -8,10 +8,12 @@ import (
 	"os/exec"
 	"os/signal"
 	"sort"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/os-autoinst/gopenqa"
+	"github.com/os-autoinst/openqa-mon/internal"
 )
 
 type winsize struct {
@@ -57,18 +59,75 @@ type TUIModel struct {
 	Instance *gopenqa.Instance // openQA instance for this config
 	Config   *Config           // Job group configuration for this model
 
-	jobs       []gopenqa.Job            // Jobs to be displayed
-	jobGroups  map[int]gopenqa.JobGroup // Job Groups
-	offset     int                      // Line offset for printing
-	printLines int                      // Lines that would need to be printed, needed for offset handling
-	reviewed   map[int64]bool           // Indicating if failed jobs are reviewed
-	sorting    int                      // Sorting method - 0: none, 1 - by job group
+	jobs       []gopenqa.Job               // Jobs to be displayed
+	jobGroups  map[int]gopenqa.JobGroup    // Job Groups
+	offset     int                         // Line offset for printing
+	printLines int                         // Lines that would need to be printed, needed for offset handling
+	reviewed   map[int64]bool              // Indicating if failed jobs are reviewed
+	refreshes  int                         // Number of started refreshes
+	updated    map[int64]int               // Refresh in which the jobs have been updated the last time
+	sorting    int                         // Sorting method - 0: none, 1 - by job group
+	notifiers  internal.Notifiers          // Notification backends
+	rules      *internal.NotificationRules // Rules which jobs to notify about
+	aggregator *internal.Aggregator        // Notification batching and rate limiting
+	mutex      sync.Mutex                  // Guards reviewed, refreshes and updated, which are also read when rendering or updating the metrics via RabbitMQ
+}
+
+// Notify queues a notification about the given job, if the notification rules of this model apply. Queued notifications are sent once the aggregator is done
+func (model *TUIModel) Notify(text string, job gopenqa.Job) {
+	ok, backends := model.rules.Notify(job)
+	if !ok {
+		return
+	}
+	model.aggregator.Add(internal.Notification{Title: "openqa-revtui", Text: text, Jobs: []gopenqa.Job{job}}, backends)
+}
+
+// send delivers the given notification via the given notification backends of this model
+func (model *TUIModel) send(notification internal.Notification, backends []string) {
+	if err := model.notifiers.Select(backends).Notify(notification); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending notification: %s\n", err)
+	}
 }
 
 func (model *TUIModel) SetReviewed(job int64, reviewed bool) {
+	model.mutex.Lock()
+	defer model.mutex.Unlock()
 	model.reviewed[job] = reviewed
 }
 
+// IsReviewed returns true if the given job is reviewed
+func (model *TUIModel) IsReviewed(job int64) bool {
+	model.mutex.Lock()
+	defer model.mutex.Unlock()
+	return model.reviewed[job]
+}
+
+// StartRefresh counts a new refresh. Jobs that are not updated in this refresh get older
+func (model *TUIModel) StartRefresh() {
+	model.mutex.Lock()
+	defer model.mutex.Unlock()
+	model.refreshes++
+}
+
+// Touch marks the given jobs as updated in the current refresh
+func (model *TUIModel) Touch(jobs []gopenqa.Job) {
+	model.mutex.Lock()
+	defer model.mutex.Unlock()
+	for _, job := range jobs {
+		model.updated[job.ID] = model.refreshes
+	}
+}
+
+// Age returns the number of refreshes since the given job has been updated the last time
+func (model *TUIModel) Age(job gopenqa.Job) int {
+	model.mutex.Lock()
+	defer model.mutex.Unlock()
+	if updated, ok := model.updated[job.ID]; ok {
+		return model.refreshes - updated
+	}
+	return 0
+}
+
 func (model *TUIModel) HideJob(job gopenqa.Job) bool {
 	status := job.JobState()
 	for _, s := range model.Config.HideStatus {
@@ -106,6 +165,14 @@ func (tui *TUIModel) SetJobGroups(grps map[int]gopenqa.JobGroup) {
 	tui.jobGroups = grps
 }
 
+// GroupName returns the name of the given job group, or its ID if the group is unknown
+func (model *TUIModel) GroupName(id int) string {
+	if grp, ok := model.jobGroups[id]; ok {
+		return grp.Name
+	}
+	return fmt.Sprintf("%d", id)
+}
+
 // Apply sorting method. 0 = none, 1 = by job group
 func (tui *TUIModel) SetSorting(sorting int) {
 	tui.sorting = sorting
@@ -196,13 +263,12 @@ func (tui *TUI) SetHeader(header string) {
 }
 
 func (tui *TUI) CreateTUIModel(cf *Config) *TUIModel {
-	instance := gopenqa.CreateInstance(cf.Instance)
-	instance.SetUserAgent("openqa-mon/revtui")
-	tui.Tabs = append(tui.Tabs, TUIModel{Instance: &instance, Config: cf})
+	tui.Tabs = append(tui.Tabs, TUIModel{Instance: instances.Get(cf.Instance), Config: cf})
 	model := &tui.Tabs[len(tui.Tabs)-1]
 	model.jobGroups = make(map[int]gopenqa.JobGroup)
 	model.jobs = make([]gopenqa.Job, 0)
 	model.reviewed = make(map[int64]bool)
+	model.updated = make(map[int64]int)
 	return model
 }
 
@@ -291,7 +357,7 @@ func (tui *TUI) hideJob(job gopenqa.Job) bool {
 
 		// Special reviewed keyword
 		if s == "reviewed" && (state == "failed" || state == "parallel_failed" || state == "incomplete") {
-			if reviewed, found := model.reviewed[job.ID]; found && reviewed {
+			if model.IsReviewed(job.ID) {
 				return true
 			}
 		}
@@ -368,7 +434,7 @@ func (tui *TUI) buildJobsScreenByGroup(width int) []string {
 			}
 			// Increase status counter
 			status := job.JobState()
-			if status == "failed" && model.reviewed[job.ID] {
+			if status == "failed" && model.IsReviewed(job.ID) {
 				status = "reviewed"
 			}
 			if c, exists := statC[status]; exists {
@@ -571,12 +637,18 @@ func (tui *TUI) formatJobLine(job gopenqa.Job, width int) string {
 	}
 	// For failed jobs check if they are reviewed
 	if state == "failed" || state == "incomplete" || state == "parallel_failed" {
-		if reviewed, found := model.reviewed[job.ID]; found && reviewed {
+		if model.IsReviewed(job.ID) {
 			c2 = ANSI_MAGENTA
 			state = "reviewed"
 		}
 	}
 
+	// Mark jobs with outdated data
+	name := job.Name
+	if age := model.Age(job); model.Config.AgeMarker > 0 && age >= model.Config.AgeMarker {
+		name = fmt.Sprintf("[%d refreshes old] %s", age, name)
+	}
+
 	// Crop the state field, if necessary
 	if state == "timeout_exceeded" {
 		state = "timeout"
@@ -587,7 +659,7 @@ func (tui *TUI) formatJobLine(job gopenqa.Job, width int) string {
 	// Full status line requires 89 characters (20+4+8+1+12+1+40+3) plus name
 	if width > 90 {
 		// Crop the name, if necessary
-		cname := job.Name
+		cname := name
 		nName := len(cname)
 		if width < 89+nName {
 			cname = cname[:width-90]
@@ -602,7 +674,7 @@ func (tui *TUI) formatJobLine(job gopenqa.Job, width int) string {
 		if link == "" {
 			link = fmt.Sprintf("%-40d", job.ID)
 		}
-		cname := job.Name
+		cname := name
 		nName := len(cname)
 		if width < 58+nName {
 			// Ensure width > 58 with upper if!
@@ -611,7 +683,7 @@ func (tui *TUI) formatJobLine(job gopenqa.Job, width int) string {
 		return fmt.Sprintf("%40s %s%-12s%s | %s", link, c2, state, ANSI_RESET+ANSI_WHITE, cname)
 	} else {
 		// Simpliest case: Just enough room for cropped name+state
-		cname := job.Name
+		cname := name
 		// Crop name if necessary
 		if 13+len(job.Name) > width {
 			if width > 13 {
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
 	"os/user"
 	"sort"
 	"strings"
@@ -114,15 +113,6 @@ func spaces(n int) string {
 	return ret
 }
 
-// NotifySend fires a Desktop notification
-func NotifySend(text string) {
-	cmd := exec.Command("notify-send", text)
-	err := cmd.Run()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error sending notification via 'notify-send': %s\n", err)
-	}
-}
-
 func cut(text string, n int) string {
 	if len(text) < n {
 		return text
@@ -0,0 +1,195 @@
+// notification batching and rate limiting shared between the different openqa-mon applications
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// Aggregator coalesces job notifications into summary notifications and limits the number of notifications per minute.
+// Notifications are collected until the coalescing window elapses, or until a batch is done if there is no window.
+// Notifications that exceed the rate limit are not dropped, but delivered as part of a later summary
+type Aggregator struct {
+	Window       time.Duration            // Coalescing window. 0 means to coalesce only the notifications of a single batch
+	MaxPerMinute int                      // Maximum number of notifications per minute. 0 means no limit
+	Title        string                   // Title of summary notifications
+	Build        func(gopenqa.Job) string // Determines the build of a job for the summary. Defaults to the build from the job name. Must not perform any request
+
+	send    func(Notification, []string) // Delivery of a notification via the given backends
+	pending []pendingNotification
+	sent    []time.Time // Delivery times of the notifications within the last minute
+	timer   *time.Timer
+	mutex   sync.Mutex
+}
+
+// pendingNotification is a notification that is waiting for delivery
+type pendingNotification struct {
+	Notification Notification
+	Backends     []string
+}
+
+// Matches the build in the job name, e.g. "opensuse-Tumbleweed-DVD-x86_64-Build20240101-textmode@64bit"
+var buildRegex = regexp.MustCompile(`-Build([^-]+)-`)
+
+// CreateAggregator creates a new aggregator, which delivers the notifications via send
+func CreateAggregator(title string, window time.Duration, maxPerMinute int, send func(Notification, []string)) *Aggregator {
+	var agg Aggregator
+	agg.Title = title
+	agg.Window = window
+	agg.MaxPerMinute = maxPerMinute
+	agg.Build = BuildFromName
+	agg.send = send
+	agg.pending = make([]pendingNotification, 0)
+	agg.sent = make([]time.Time, 0)
+	return &agg
+}
+
+// BuildFromName extracts the build from the name of the given job, or returns an empty string if not present
+func BuildFromName(job gopenqa.Job) string {
+	if match := buildRegex.FindStringSubmatch(job.Name); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// Add queues the given notification for delivery via the given backends
+func (agg *Aggregator) Add(notification Notification, backends []string) {
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+	agg.pending = append(agg.pending, pendingNotification{Notification: notification, Backends: backends})
+	if agg.Window > 0 {
+		agg.schedule(agg.Window)
+	}
+}
+
+// Done marks the end of a batch of notifications. Without coalescing window, the batch is delivered immediately
+func (agg *Aggregator) Done() {
+	if agg.Window <= 0 {
+		agg.Flush()
+	}
+}
+
+// Flush delivers all pending notifications now, as far as the rate limit allows
+func (agg *Aggregator) Flush() {
+	for _, notification := range agg.take(time.Now()) {
+		agg.send(notification.Notification, notification.Backends)
+	}
+}
+
+// Schedule a flush after the given delay, unless a flush is already scheduled
+func (agg *Aggregator) schedule(delay time.Duration) {
+	if agg.timer == nil {
+		agg.timer = time.AfterFunc(delay, func() {
+			agg.mutex.Lock()
+			agg.timer = nil
+			agg.mutex.Unlock()
+			agg.Flush()
+		})
+	}
+}
+
+// take removes the notifications that can be delivered at the given time from the pending notifications and returns them
+func (agg *Aggregator) take(now time.Time) []pendingNotification {
+	agg.mutex.Lock()
+	defer agg.mutex.Unlock()
+	ret := make([]pendingNotification, 0)
+	if len(agg.pending) == 0 {
+		return ret
+	}
+	// Forget about notifications older than a minute
+	sent := make([]time.Time, 0)
+	for _, t := range agg.sent {
+		if now.Sub(t) < time.Minute {
+			sent = append(sent, t)
+		}
+	}
+	agg.sent = sent
+
+	groups := agg.summarize(agg.pending)
+	n := len(groups)
+	if agg.MaxPerMinute > 0 {
+		n = min(n, agg.MaxPerMinute-len(agg.sent))
+	}
+	ret = append(ret, groups[:max(0, n)]...)
+	for range ret {
+		agg.sent = append(agg.sent, now)
+	}
+	agg.pending = groups[max(0, n):]
+	// Remaining notifications are delivered, once the rate limit allows it again
+	if len(agg.pending) > 0 && len(agg.sent) > 0 {
+		agg.schedule(time.Minute - now.Sub(agg.sent[0]))
+	}
+	return ret
+}
+
+// summarize groups the given notifications by remote, build and backends and creates a summary notification for every group with more than one notification
+func (agg *Aggregator) summarize(notifications []pendingNotification) []pendingNotification {
+	keys := make([]string, 0)
+	groups := make(map[string][]pendingNotification, 0)
+	for _, notification := range notifications {
+		remote, build := "", ""
+		if len(notification.Notification.Jobs) > 0 {
+			job := notification.Notification.Jobs[0]
+			remote, build = job.Remote, agg.Build(job)
+		}
+		key := fmt.Sprintf("%s|%s|%s", remote, build, strings.Join(notification.Backends, ","))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], notification)
+	}
+
+	ret := make([]pendingNotification, 0)
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 {
+			ret = append(ret, group[0])
+			continue
+		}
+		jobs := make([]gopenqa.Job, 0)
+		for _, notification := range group {
+			jobs = append(jobs, notification.Notification.Jobs...)
+		}
+		ret = append(ret, pendingNotification{Notification: agg.Summary(jobs), Backends: group[0].Backends})
+	}
+	return ret
+}
+
+// Summary creates the summary notification for the given jobs, e.g. "14 failed, 3 incomplete in build X", followed by a link to the overview
+func (agg *Aggregator) Summary(jobs []gopenqa.Job) Notification {
+	counts := make(map[string]int, 0)
+	states := make([]string, 0)
+	for _, job := range jobs {
+		state := job.JobState()
+		if _, ok := counts[state]; !ok {
+			states = append(states, state)
+		}
+		counts[state]++
+	}
+	sort.SliceStable(states, func(i, j int) bool { return counts[states[i]] > counts[states[j]] })
+	summary := make([]string, 0)
+	for _, state := range states {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[state], state))
+	}
+	text := strings.Join(summary, ", ")
+
+	if len(jobs) > 0 {
+		remote, build := strings.TrimRight(jobs[0].Remote, "/"), agg.Build(jobs[0])
+		if build != "" {
+			text += " in build " + build
+			if remote != "" {
+				text += "\n" + remote + "/tests/overview?build=" + url.QueryEscape(build)
+			}
+		} else if remote != "" {
+			text += "\n" + remote + "/tests"
+		}
+	}
+	return Notification{Title: fmt.Sprintf("%s: %d jobs", agg.Title, len(jobs)), Text: text, Jobs: jobs}
+}
@@ -0,0 +1,119 @@
+// Prometheus metrics shared between the different openqa-mon applications
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics is a minimal registry for metrics in the Prometheus text exposition format
+type Metrics struct {
+	families map[string]*metricFamily
+	names    []string // Metric names in order of their registration
+	mutex    sync.Mutex
+}
+
+// metricFamily contains all samples of a single metric
+type metricFamily struct {
+	Type    string             // "gauge" or "counter"
+	Help    string             // Metric description
+	Samples map[string]float64 // Sample values by their rendered labels
+}
+
+func CreateMetrics() *Metrics {
+	var metrics Metrics
+	metrics.families = make(map[string]*metricFamily, 0)
+	metrics.names = make([]string, 0)
+	return &metrics
+}
+
+// Register a metric with the given name, type ("gauge" or "counter") and description
+func (metrics *Metrics) Register(name string, metricType string, help string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if _, ok := metrics.families[name]; !ok {
+		metrics.names = append(metrics.names, name)
+	}
+	metrics.families[name] = &metricFamily{Type: metricType, Help: help, Samples: make(map[string]float64, 0)}
+}
+
+// Set the value of the sample with the given labels. labels are name and value pairs
+func (metrics *Metrics) Set(name string, value float64, labels ...string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if family, ok := metrics.families[name]; ok {
+		family.Samples[renderLabels(labels)] = value
+	}
+}
+
+// Add the given value to the sample with the given labels. labels are name and value pairs
+func (metrics *Metrics) Add(name string, value float64, labels ...string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if family, ok := metrics.families[name]; ok {
+		family.Samples[renderLabels(labels)] += value
+	}
+}
+
+// Reset removes all samples of the given metric, e.g. before a gauge is recomputed
+func (metrics *Metrics) Reset(name string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	if family, ok := metrics.families[name]; ok {
+		family.Samples = make(map[string]float64, 0)
+	}
+}
+
+// Write all metrics in the Prometheus text exposition format
+func (metrics *Metrics) Write(w io.Writer) error {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	for _, name := range metrics.names {
+		family := metrics.families[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.Help, name, family.Type); err != nil {
+			return err
+		}
+		labels := make([]string, 0, len(family.Samples))
+		for label := range family.Samples {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, label, strconv.FormatFloat(family.Samples[label], 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Write(w)
+}
+
+// Serve serves the metrics at /metrics on the given listener. Blocks until the server fails
+func (metrics *Metrics) Serve(listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	return http.Serve(listener, mux)
+}
+
+// Render the given label name and value pairs, e.g. {remote="openqa.opensuse.org",state="failed"}
+func renderLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := make([]string, 0)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
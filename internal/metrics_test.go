@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := CreateMetrics()
+	metrics.Register("jobs", "gauge", "Number of jobs")
+	metrics.Register("errors_total", "counter", "Number of errors")
+	metrics.Set("jobs", 3, "remote", "openqa.opensuse.org", "state", "done")
+	metrics.Set("jobs", 1, "remote", "openqa \"local\"\n", "state", "running")
+	metrics.Add("errors_total", 1)
+	metrics.Add("errors_total", 2)
+	metrics.Set("unknown", 1) // Unregistered metrics are ignored
+
+	expected := `# HELP jobs Number of jobs
+# TYPE jobs gauge
+jobs{remote="openqa \"local\"\n",state="running"} 1
+jobs{remote="openqa.opensuse.org",state="done"} 3
+# HELP errors_total Number of errors
+# TYPE errors_total counter
+errors_total 3
+`
+	var buf strings.Builder
+	if err := metrics.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Unexpected metrics:\n%s", buf.String())
+	}
+
+	metrics.Reset("jobs")
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); strings.Contains(body, "jobs{") || !strings.Contains(body, "errors_total 3") {
+		t.Errorf("Unexpected metrics after reset:\n%s", body)
+	}
+}
@@ -0,0 +1,279 @@
+// notification backends shared between the different openqa-mon applications
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// Notification is a message about one or more jobs
+type Notification struct {
+	Title string        // Short summary
+	Text  string        // Notification text
+	Jobs  []gopenqa.Job // Jobs this notification is about
+}
+
+// Notifier is a notification backend
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// Notifiers combines multiple notification backends by their name. All backends are notified, regardless of errors in other backends
+type Notifiers map[string]Notifier
+
+// NotifierConfig selects and configures the notification backends
+type NotifierConfig struct {
+	Backends     []string // Enabled backends: "desktop", "command", "webhook", "email", "osc9" or "osc777". Defaults to "desktop"
+	Command      string   // Command for the "command" backend, executed via "sh -c"
+	Webhook      string   // URL for the "webhook" backend
+	SMTPServer   string   // SMTP server (host:port) for the "email" backend
+	SMTPUsername string   // SMTP username, if authentication is required
+	SMTPPassword string   // SMTP password, if authentication is required
+	EmailFrom    string   // Sender address for the "email" backend
+	EmailTo      []string // Recipient addresses for the "email" backend
+}
+
+// DesktopNotifier sends desktop notifications via notify-send
+type DesktopNotifier struct{}
+
+// CommandNotifier executes a command for every notification. The notification and job fields are passed as OPENQA_* environment variables
+type CommandNotifier struct {
+	Command string
+}
+
+// WebhookNotifier posts every notification as json to a URL. The payload contains a "text" field, which is understood by most chat services (e.g. Slack or Matrix hookshot)
+type WebhookNotifier struct {
+	URL string
+}
+
+// EmailNotifier sends every notification as email via SMTP
+type EmailNotifier struct {
+	Server   string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// TerminalNotifier sends terminal-native notifications via the OSC 9 or OSC 777 escape sequences
+type TerminalNotifier struct {
+	Protocol int       // 9 or 777
+	Writer   io.Writer // Terminal to write to
+}
+
+// notificationJob is the representation of a job in the webhook payload
+type notificationJob struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Test   string `json:"test"`
+	State  string `json:"state"`
+	Result string `json:"result"`
+	Status string `json:"status"`
+	Link   string `json:"link"`
+	Remote string `json:"remote"`
+}
+
+// CreateNotifiers creates the configured notification backends
+func CreateNotifiers(cf NotifierConfig) (Notifiers, error) {
+	ret := make(Notifiers, 0)
+	backends := cf.Backends
+	if len(backends) == 0 {
+		backends = []string{"desktop"}
+	}
+	for _, backend := range backends {
+		name := notifierName(backend)
+		switch name {
+		case "desktop":
+			ret[name] = DesktopNotifier{}
+		case "command":
+			if cf.Command == "" {
+				return ret, fmt.Errorf("command notifier requires a command")
+			}
+			ret[name] = CommandNotifier{Command: cf.Command}
+		case "webhook":
+			if cf.Webhook == "" {
+				return ret, fmt.Errorf("webhook notifier requires a URL")
+			}
+			ret[name] = WebhookNotifier{URL: cf.Webhook}
+		case "email":
+			if cf.SMTPServer == "" || cf.EmailFrom == "" || len(cf.EmailTo) == 0 {
+				return ret, fmt.Errorf("email notifier requires a SMTP server, sender and recipients")
+			}
+			ret[name] = EmailNotifier{Server: cf.SMTPServer, Username: cf.SMTPUsername, Password: cf.SMTPPassword, From: cf.EmailFrom, To: cf.EmailTo}
+		case "osc9":
+			ret[name] = TerminalNotifier{Protocol: 9, Writer: os.Stdout}
+		case "osc777":
+			ret[name] = TerminalNotifier{Protocol: 777, Writer: os.Stdout}
+		default:
+			return ret, fmt.Errorf("unknown notifier: %s", backend)
+		}
+	}
+	return ret, nil
+}
+
+// Canonical name of the given notification backend
+func notifierName(backend string) string {
+	name := strings.ToLower(strings.TrimSpace(backend))
+	switch name {
+	case "notify-send":
+		return "desktop"
+	case "smtp":
+		return "email"
+	case "osc":
+		return "osc9"
+	}
+	return name
+}
+
+// Select returns the given backends. An empty selection returns all backends
+func (notifiers Notifiers) Select(backends []string) Notifiers {
+	if len(backends) == 0 {
+		return notifiers
+	}
+	ret := make(Notifiers, 0)
+	for _, backend := range backends {
+		name := notifierName(backend)
+		if notifier, ok := notifiers[name]; ok {
+			ret[name] = notifier
+		}
+	}
+	return ret
+}
+
+// Notify sends the notification via all backends and returns the combined errors
+func (notifiers Notifiers) Notify(notification Notification) error {
+	errs := make([]error, 0)
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (notifier DesktopNotifier) Notify(notification Notification) error {
+	if err := exec.Command("notify-send", notification.Text).Run(); err != nil {
+		return fmt.Errorf("notify-send: %s", err)
+	}
+	return nil
+}
+
+func (notifier CommandNotifier) Notify(notification Notification) error {
+	cmd := exec.Command("sh", "-c", notifier.Command)
+	cmd.Env = append(os.Environ(), "OPENQA_TITLE="+notification.Title, "OPENQA_TEXT="+notification.Text, fmt.Sprintf("OPENQA_JOB_COUNT=%d", len(notification.Jobs)))
+	ids := make([]string, 0)
+	for _, job := range notification.Jobs {
+		ids = append(ids, fmt.Sprintf("%d", job.ID))
+	}
+	cmd.Env = append(cmd.Env, "OPENQA_JOB_IDS="+strings.Join(ids, ","))
+	// Fields of the first job, for the common case of a notification about a single job
+	if len(notification.Jobs) > 0 {
+		job := notification.Jobs[0]
+		cmd.Env = append(cmd.Env, fmt.Sprintf("OPENQA_JOB_ID=%d", job.ID), "OPENQA_JOB_NAME="+job.Name, "OPENQA_JOB_TEST="+job.Test, "OPENQA_JOB_STATE="+job.State, "OPENQA_JOB_RESULT="+job.Result, "OPENQA_JOB_STATUS="+job.JobState(), "OPENQA_JOB_LINK="+job.Link, "OPENQA_JOB_REMOTE="+job.Remote, "OPENQA_JOB_MACHINE="+job.Settings.Machine, "OPENQA_JOB_ARCH="+job.Settings.Arch)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notification command: %s %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (notifier WebhookNotifier) Notify(notification Notification) error {
+	payload := struct {
+		Title string            `json:"title"`
+		Text  string            `json:"text"`
+		Jobs  []notificationJob `json:"jobs"`
+	}{Title: notification.Title, Text: notification.Text, Jobs: make([]notificationJob, 0)}
+	for _, job := range notification.Jobs {
+		payload.Jobs = append(payload.Jobs, notificationJob{ID: job.ID, Name: job.Name, Test: job.Test, State: job.State, Result: job.Result, Status: job.JobState(), Link: job.Link, Remote: job.Remote})
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	c := http.Client{Timeout: 30 * time.Second}
+	r, err := c.Post(notifier.URL, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("webhook: %s", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("webhook: http status code %d", r.StatusCode)
+	}
+	return nil
+}
+
+func (notifier EmailNotifier) Notify(notification Notification) error {
+	var auth smtp.Auth
+	if notifier.Username != "" {
+		host := notifier.Server
+		if i := strings.LastIndex(host, ":"); i > 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", notifier.Username, notifier.Password, host)
+	}
+	subject := notification.Title
+	if subject == "" {
+		subject = firstLine(notification.Text)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", notifier.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(notifier.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(notification.Text, "\n", "\r\n"))
+	for _, job := range notification.Jobs {
+		if job.Link != "" {
+			fmt.Fprintf(&msg, "\r\n%s", job.Link)
+		}
+	}
+	msg.WriteString("\r\n")
+	if err := smtp.SendMail(notifier.Server, auth, notifier.From, notifier.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	return nil
+}
+
+func (notifier TerminalNotifier) Notify(notification Notification) error {
+	var err error
+	text := oscSanitize(notification.Text)
+	switch notifier.Protocol {
+	case 777:
+		title := strings.ReplaceAll(oscSanitize(notification.Title), ";", ",")
+		_, err = fmt.Fprintf(notifier.Writer, "\x1b]777;notify;%s;%s\x07", title, text)
+	default:
+		_, err = fmt.Fprintf(notifier.Writer, "\x1b]9;%s\x07", text)
+	}
+	return err
+}
+
+// Remove control characters from text for usage in an OSC escape sequence
+func oscSanitize(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return ' '
+		} else if r < 32 || r == 127 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(text))
+}
+
+// Return the first line of the given text
+func firstLine(text string) string {
+	if i := strings.Index(text, "\n"); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+func TestNotifiers(t *testing.T) {
+	if _, err := CreateNotifiers(NotifierConfig{Backends: []string{"webhook"}}); err == nil {
+		t.Error("Expected error for webhook notifier without URL")
+	}
+	if _, err := CreateNotifiers(NotifierConfig{Backends: []string{"pigeon"}}); err == nil {
+		t.Error("Expected error for unknown notifier")
+	}
+	if notifiers, err := CreateNotifiers(NotifierConfig{}); err != nil || len(notifiers) != 1 {
+		t.Error("Expected desktop notifier as default, got", notifiers, err)
+	}
+
+	job := gopenqa.Job{ID: 42, Name: "opensuse-Tumbleweed-DVD-x86_64-Build20240101-textmode@64bit", Test: "textmode", State: "done", Result: "failed"}
+	notification := Notification{Title: "openqa-mon", Text: "[failed] - Job 42\ttextmode\x1b[31m", Jobs: []gopenqa.Job{job}}
+
+	var buf strings.Builder
+	if err := (TerminalNotifier{Protocol: 777, Writer: &buf}).Notify(notification); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\x1b]777;notify;openqa-mon;[failed] - Job 42 textmode[31m\x07"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	var payload struct {
+		Text string `json:"text"`
+		Jobs []struct {
+			ID     int64  `json:"id"`
+			Status string `json:"status"`
+		} `json:"jobs"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	if err := (WebhookNotifier{URL: server.URL}).Notify(notification); err != nil {
+		t.Fatal("Webhook error:", err)
+	}
+	if payload.Text != notification.Text || len(payload.Jobs) != 1 || payload.Jobs[0].ID != 42 || payload.Jobs[0].Status != "failed" {
+		t.Error("Unexpected webhook payload:", payload)
+	}
+}
+
+func TestNotificationRules(t *testing.T) {
+	rule, err := ParseNotificationRule("states=passed test=^textmode notifiers=desktop")
+	if err != nil {
+		t.Fatal("Error parsing rule:", err)
+	}
+	if !reflect.DeepEqual(rule, NotificationRule{States: []string{"passed"}, Test: "^textmode", Notifiers: []string{"desktop"}}) {
+		t.Error("Unexpected rule:", rule)
+	}
+	if _, err := ParseNotificationRule("colour=red"); err == nil {
+		t.Error("Expected error for invalid rule field")
+	}
+	rules := []NotificationRule{
+		rule,
+		{Remote: "openqa.suse.de", States: []string{"failed", "incomplete"}, Notifiers: []string{"webhook"}},
+		{States: []string{"failed", "incomplete"}},
+	}
+	engine, err := CreateNotificationRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		job      gopenqa.Job
+		notify   bool
+		backends []string
+	}{
+		{gopenqa.Job{State: "done", Result: "passed", Test: "textmode", Remote: "https://openqa.opensuse.org"}, true, []string{"desktop"}},
+		{gopenqa.Job{State: "done", Result: "passed", Test: "gnome", Remote: "https://openqa.opensuse.org"}, false, nil},
+		{gopenqa.Job{State: "done", Result: "failed", Test: "gnome", Remote: "https://openqa.suse.de"}, true, []string{"webhook"}},
+		{gopenqa.Job{State: "done", Result: "incomplete", Test: "gnome", Remote: "https://openqa.opensuse.org"}, true, nil},
+		{gopenqa.Job{State: "running", Test: "gnome", Remote: "https://openqa.opensuse.org"}, false, nil},
+	}
+	for _, test := range tests {
+		if notify, backends := engine.Notify(test.job); notify != test.notify || !reflect.DeepEqual(backends, test.backends) {
+			t.Errorf("%s %s on %s: expected %v %v, got %v %v", test.job.Test, test.job.JobState(), test.job.Remote, test.notify, test.backends, notify, backends)
+		}
+	}
+
+	// Default rules ignore trivial state changes
+	engine, _ = CreateNotificationRules(nil)
+	if notify, _ := engine.Notify(gopenqa.Job{State: "uploading"}); notify {
+		t.Error("Expected uploading jobs to be ignored by default")
+	}
+	if notify, _ := engine.Notify(gopenqa.Job{State: "done", Result: "passed"}); !notify {
+		t.Error("Expected passed jobs to be notified by default")
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	sent := make([]Notification, 0)
+	agg := CreateAggregator("openqa-mon", 0, 2, func(notification Notification, backends []string) {
+		sent = append(sent, notification)
+	})
+	job := func(id int64, build string, result string) gopenqa.Job {
+		return gopenqa.Job{ID: id, Name: "opensuse-Tumbleweed-DVD-x86_64-Build" + build + "-textmode@64bit", State: "done", Result: result, Remote: "https://openqa.opensuse.org"}
+	}
+	add := func(job gopenqa.Job) {
+		agg.Add(Notification{Title: "openqa-mon", Text: fmt.Sprintf("Job %d", job.ID), Jobs: []gopenqa.Job{job}}, nil)
+	}
+	for i := int64(1); i <= 3; i++ {
+		add(job(i, "20240101", "failed"))
+	}
+	add(job(4, "20240101", "incomplete"))
+	add(job(5, "20240102", "failed"))
+	agg.Done()
+	if len(sent) != 2 {
+		t.Fatal("Expected two notifications, got", sent)
+	}
+	if expected := "3 failed, 1 incomplete in build 20240101\nhttps://openqa.opensuse.org/tests/overview?build=20240101"; sent[0].Text != expected || len(sent[0].Jobs) != 4 {
+		t.Errorf("Expected summary %q, got %q", expected, sent[0].Text)
+	}
+	if sent[1].Text != "Job 5" {
+		t.Error("Expected single notification to remain unchanged, got", sent[1].Text)
+	}
+	// Rate limit is reached, further notifications are deferred
+	add(job(6, "20240103", "passed"))
+	agg.Done()
+	if len(sent) != 2 {
+		t.Error("Expected notification to be deferred by the rate limit, got", sent)
+	}
+}
@@ -0,0 +1,250 @@
+// openQA instances and API credentials shared between the different openqa-mon applications
+package internal
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// Credentials are the API key and secret for an openQA host, as defined in the openQA client.conf
+type Credentials struct {
+	Hostname string // openQA host these credentials belong to
+	Key      string // API key
+	Secret   string // API secret
+}
+
+// Instances hands out configured and reusable openQA instances per remote
+type Instances struct {
+	userAgent         string
+	maxRecursionDepth int
+	credentials       map[string]Credentials
+	instances         map[string]*gopenqa.Instance
+	parallel          bool // Allow parallel requests to the same instance
+	mutex             sync.Mutex
+}
+
+// Hostname extracts the hostname (including the port, if present) from the given uri
+func Hostname(uri string) string {
+	hostname := uri
+	// First trim the protocol (if present)
+	if i := strings.Index(hostname, "://"); i > 0 {
+		hostname = hostname[i+3:]
+	}
+	// Trim the path (if present)
+	if i := strings.Index(hostname, "/"); i > 0 {
+		hostname = hostname[:i]
+	}
+	return hostname
+}
+
+// Ensure the given remote has a http or https prefix and no trailing slash
+func normalizeRemote(remote string) string {
+	remote = strings.TrimRight(remote, "/")
+	if !(strings.HasPrefix(remote, "http://") || strings.HasPrefix(remote, "https://")) {
+		return "http://" + remote
+	}
+	return remote
+}
+
+// ReadClientConf reads the openQA API credentials from the given client.conf file. Returns an empty slice and nil if the file doesn't exists.
+func ReadClientConf(filename string) ([]Credentials, error) {
+	ret := make([]Credentials, 0)
+	var current Credentials
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return ret, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return ret, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	iLine := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		iLine++
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if len(line) > 2 && (line[0] == '[' && line[len(line)-1] == ']') {
+			if current.Hostname != "" {
+				ret = append(ret, current)
+			}
+			// Sections can be a hostname or a URL
+			current = Credentials{Hostname: Hostname(strings.TrimSpace(line[1 : len(line)-1]))}
+		} else if line[0] == '[' || line[len(line)-1] == ']' {
+			return ret, fmt.Errorf("%s (Line %d)", "Invalid section header", iLine)
+		} else {
+			i := strings.Index(line, "=")
+			if i < 0 {
+				return ret, fmt.Errorf("Config file syntax error (Line %d)", iLine)
+			}
+			name := strings.ToLower(strings.TrimSpace(line[:i]))
+			value := strings.TrimSpace(line[i+1:])
+
+			switch name {
+			case "key":
+				current.Key = value
+			case "secret":
+				current.Secret = value
+			}
+		}
+	}
+	if current.Hostname != "" {
+		ret = append(ret, current)
+	}
+
+	return ret, scanner.Err()
+}
+
+// ReadClientConfs reads the system-wide and the user client.conf files and assembles the API credentials per host.
+// The user config takes precedence over the system-wide config
+func ReadClientConfs() (map[string]Credentials, error) {
+	ret := make(map[string]Credentials)
+	filenames := []string{"/etc/openqa/client.conf"}
+	if usr, err := user.Current(); err == nil {
+		filenames = append(filenames, usr.HomeDir+"/.config/openqa/client.conf")
+	}
+	for _, filename := range filenames {
+		creds, err := ReadClientConf(filename)
+		if err != nil {
+			return ret, fmt.Errorf("%s: %s", filename, err)
+		}
+		for _, cred := range creds {
+			ret[cred.Hostname] = cred
+		}
+	}
+	return ret, nil
+}
+
+// CreateInstances creates the instance registry for the given user agent and maximum recursion depth for following jobs
+func CreateInstances(userAgent string, maxRecursionDepth int) *Instances {
+	var inst Instances
+	inst.userAgent = userAgent
+	inst.maxRecursionDepth = maxRecursionDepth
+	inst.credentials = make(map[string]Credentials, 0)
+	inst.instances = make(map[string]*gopenqa.Instance, 0)
+	return &inst
+}
+
+// LoadCredentials reads the API credentials from the default client.conf files
+func (inst *Instances) LoadCredentials() error {
+	creds, err := ReadClientConfs()
+	inst.SetCredentials(creds)
+	return err
+}
+
+// SetCredentials replaces the API credentials. Already handed out instances are updated as well
+func (inst *Instances) SetCredentials(creds map[string]Credentials) {
+	inst.mutex.Lock()
+	defer inst.mutex.Unlock()
+	inst.credentials = creds
+	for remote, instance := range inst.instances {
+		if cred, ok := creds[Hostname(remote)]; ok {
+			instance.SetApiKey(cred.Key, cred.Secret)
+		}
+	}
+}
+
+// SetParallel allows or disallows parallel requests to the same instance. By default, requests to an instance are serialized
+func (inst *Instances) SetParallel(parallel bool) {
+	inst.mutex.Lock()
+	defer inst.mutex.Unlock()
+	inst.parallel = parallel
+	for _, instance := range inst.instances {
+		instance.SetAllowParallel(parallel)
+	}
+}
+
+// Credentials returns the API credentials for the given remote, and true if present
+func (inst *Instances) Credentials(remote string) (Credentials, bool) {
+	inst.mutex.Lock()
+	defer inst.mutex.Unlock()
+	cred, ok := inst.credentials[Hostname(remote)]
+	return cred, ok && cred.Key != "" && cred.Secret != ""
+}
+
+// Get returns the instance for the given remote. Instances are created on first use and reused afterwards
+func (inst *Instances) Get(remote string) *gopenqa.Instance {
+	remote = normalizeRemote(remote)
+	inst.mutex.Lock()
+	defer inst.mutex.Unlock()
+	if instance, ok := inst.instances[remote]; ok {
+		return instance
+	}
+	instance := gopenqa.CreateInstance(remote)
+	instance.SetUserAgent(inst.userAgent)
+	instance.SetMaxRecursionDepth(inst.maxRecursionDepth)
+	instance.SetAllowParallel(inst.parallel)
+	if cred, ok := inst.credentials[Hostname(remote)]; ok {
+		instance.SetApiKey(cred.Key, cred.Secret)
+	}
+	inst.instances[remote] = &instance
+	return &instance
+}
+
+// Post performs an authenticated POST request on the given API path (e.g. /api/v1/jobs/1/restart) of the remote and unmarshals the returned json into v, if not nil
+func (inst *Instances) Post(remote string, path string, v interface{}) error {
+	remote = normalizeRemote(remote)
+	cred, ok := inst.Credentials(remote)
+	if !ok {
+		return fmt.Errorf("no API key configured for %s", Hostname(remote))
+	}
+	u, err := url.Parse(remote + path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", inst.userAgent)
+	// openQA expects the request path salted with the timestamp and signed with the API secret
+	timestamp := time.Now().Unix()
+	mac := hmac.New(sha1.New, []byte(cred.Secret))
+	mac.Write([]byte(fmt.Sprintf("%s%d", u.RequestURI(), timestamp)))
+	req.Header.Set("X-API-Key", cred.Key)
+	req.Header.Set("X-API-Microtime", fmt.Sprintf("%d", timestamp))
+	req.Header.Set("X-API-Hash", fmt.Sprintf("%x", mac.Sum(nil)))
+
+	c := http.Client{Timeout: 60 * time.Second}
+	r, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != 200 {
+		// openQA returns the reason as error message
+		var result struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(buf, &result) == nil && result.Error != "" {
+			return fmt.Errorf("http status code %d: %s", r.StatusCode, strings.TrimSpace(result.Error))
+		}
+		return fmt.Errorf("http status code %d", r.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(buf, v)
+}
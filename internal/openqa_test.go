@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReadClientConf(t *testing.T) {
+	filename := t.TempDir() + "/client.conf"
+	conf := "[openqa.opensuse.org]\nkey = 1234567890ABCDEF\nsecret = FEDCBA0987654321\n\n# Sections can also be links\n[http://localhost:9526]\nkey = AAAA\nsecret = BBBB\n"
+	if err := os.WriteFile(filename, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := ReadClientConf(filename)
+	if err != nil {
+		t.Fatal("Error reading client.conf:", err)
+	}
+	expected := []Credentials{{"openqa.opensuse.org", "1234567890ABCDEF", "FEDCBA0987654321"}, {"localhost:9526", "AAAA", "BBBB"}}
+	if !reflect.DeepEqual(creds, expected) {
+		t.Error("Expected", expected, "got", creds)
+	}
+	if creds, err := ReadClientConf(filename + ".missing"); err != nil || len(creds) != 0 {
+		t.Error("Expected no credentials for missing file, got", creds, err)
+	}
+}
+
+func TestInstances(t *testing.T) {
+	instances := CreateInstances("openqa-mon-test", 10)
+	instances.SetCredentials(map[string]Credentials{"localhost:9526": {"localhost:9526", "AAAA", "BBBB"}})
+
+	// The same remote must always yield the same instance, regardless of the notation
+	instance := instances.Get("http://localhost:9526/")
+	if instances.Get("localhost:9526") != instance {
+		t.Error("Expected the instance to be reused")
+	}
+	if instances.Get("https://openqa.opensuse.org") == instance {
+		t.Error("Expected a distinct instance for a different remote")
+	}
+	if cred, ok := instances.Credentials("http://localhost:9526"); !ok || cred.Key != "AAAA" {
+		t.Error("Expected credentials for localhost:9526, got", cred)
+	}
+	if _, ok := instances.Credentials("openqa.opensuse.org"); ok {
+		t.Error("Expected no credentials for openqa.opensuse.org")
+	}
+}
@@ -0,0 +1,119 @@
+// retries of transient http errors shared between the different openqa-mon applications
+package internal
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryTransport retries idempotent requests (GET and HEAD) on network errors and on the http status codes 429, 502, 503 and 504.
+// The delay between the attempts grows exponentially with a random jitter. A Retry-After header of 429 and 503 responses is honored
+type RetryTransport struct {
+	Transport     http.RoundTripper // Underlying transport
+	Retries       int               // Maximum number of retries
+	Delay         time.Duration     // Delay before the first retry. Doubled on every retry
+	MaxDelay      time.Duration     // Upper limit for the delay between two attempts
+	MaxRetryAfter time.Duration     // Don't retry if the server asks to wait longer than this
+
+	sleep func(time.Duration)
+}
+
+// Backoff computes the delays between attempts, which grow exponentially with a random jitter
+type Backoff struct {
+	Delay    time.Duration // Delay before the first retry. Doubled on every retry
+	MaxDelay time.Duration // Upper limit for the delay between two attempts
+
+	current time.Duration
+}
+
+// Next returns the delay before the next attempt, between 50% and 100% of the current delay, and doubles the current delay
+func (b *Backoff) Next() time.Duration {
+	if b.current <= 0 {
+		b.current = max(b.Delay, 0)
+	}
+	wait := b.current/2 + time.Duration(rand.Int63n(int64(b.current/2)+1))
+	b.current = min(2*b.current, b.MaxDelay)
+	return wait
+}
+
+// Reset starts again with the initial delay, e.g. after a successful attempt
+func (b *Backoff) Reset() {
+	b.current = b.Delay
+}
+
+// CreateRetryTransport creates a retry transport on top of the given transport
+func CreateRetryTransport(transport http.RoundTripper, retries int, delay time.Duration) *RetryTransport {
+	return &RetryTransport{Transport: transport, Retries: retries, Delay: delay, MaxDelay: 30 * time.Second, MaxRetryAfter: 5 * time.Minute, sleep: time.Sleep}
+}
+
+// InstallRetryTransport enables retries for all requests via the default http transport, which is also used by gopenqa
+func InstallRetryTransport(retries int, delay time.Duration) {
+	if retries > 0 {
+		http.DefaultTransport = CreateRetryTransport(http.DefaultTransport, retries, delay)
+	}
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := req.Method == "GET" || req.Method == "HEAD" || req.Method == ""
+	// Requests with a body can only be retried, if the body can be recreated
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		idempotent = false
+	}
+	backoff := Backoff{Delay: t.Delay, MaxDelay: t.MaxDelay}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := t.Transport.RoundTrip(req)
+		if !idempotent || attempt >= t.Retries || !transient(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := backoff.Next()
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && (resp.StatusCode == 429 || resp.StatusCode == 503) {
+				if retryAfter > t.MaxRetryAfter {
+					return resp, err
+				}
+				wait = max(wait, retryAfter)
+			}
+			// Drain the body, so that the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		t.sleep(wait)
+	}
+}
+
+// Returns true if the request failed because of a transient error
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case 429, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// Parse the value of a Retry-After header, which is either a number of seconds or a http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(0, t.Sub(now)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "7")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		} else if attempts == 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	waits := make([]time.Duration, 0)
+	transport := CreateRetryTransport(http.DefaultTransport, 3, time.Second)
+	transport.sleep = func(d time.Duration) { waits = append(waits, d) }
+	client := http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "ok" || attempts != 3 {
+		t.Fatalf("Expected success after 3 attempts, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+	if len(waits) != 2 || waits[0] != 7*time.Second || waits[1] < time.Second || waits[1] > 2*time.Second {
+		t.Error("Unexpected backoff", waits)
+	}
+
+	// POST requests are not retried
+	attempts = 0
+	resp, err = client.Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if attempts != 1 {
+		t.Error("Expected a single attempt for POST requests, got", attempts)
+	}
+
+	backoff := Backoff{Delay: time.Second, MaxDelay: 3 * time.Second}
+	for _, limit := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if wait := backoff.Next(); wait < limit/2 || wait > limit {
+			t.Error("Expected backoff between", limit/2, "and", limit, "got", wait)
+		}
+	}
+	backoff.Reset()
+	if wait := backoff.Next(); wait > time.Second {
+		t.Error("Expected initial delay after reset, got", wait)
+	}
+	backoff = Backoff{Delay: -time.Second, MaxDelay: 3 * time.Second}
+	if wait := backoff.Next(); wait != 0 {
+		t.Error("Expected no delay for a negative initial delay, got", wait)
+	}
+
+	if d, ok := parseRetryAfter("Wed, 21 Oct 2015 07:28:30 GMT", time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)); !ok || d != 30*time.Second {
+		t.Error("Unexpected Retry-After date parsing", d, ok)
+	}
+}
@@ -0,0 +1,138 @@
+// notification rules shared between the different openqa-mon applications
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/os-autoinst/gopenqa"
+)
+
+// NotificationRule decides if and where notifications about a job are sent. Empty fields match all jobs
+type NotificationRule struct {
+	States    []string // Matching job states, e.g. "failed", "incomplete", "running" or "done"
+	Results   []string // Matching job results, e.g. "failed" or "softfailed"
+	Test      string   // Regular expression for matching the test name
+	Remote    string   // Matching remote, e.g. "openqa.opensuse.org"
+	Notifiers []string // Send notifications about matching jobs only via these backends. Empty means all backends
+	Ignore    bool     // Don't send notifications about matching jobs
+}
+
+// NotificationRules are evaluated in order, the first matching rule applies
+type NotificationRules struct {
+	rules []NotificationRule
+	tests []*regexp.Regexp
+}
+
+// DefaultNotificationRules ignore trivial state changes and notify about everything else
+var DefaultNotificationRules = []NotificationRule{
+	{States: []string{"uploading", "assigned", "skipped", "cancelled"}, Ignore: true},
+	{},
+}
+
+// CreateNotificationRules compiles the given rules. Without any rules, the DefaultNotificationRules apply
+func CreateNotificationRules(rules []NotificationRule) (*NotificationRules, error) {
+	if len(rules) == 0 {
+		rules = DefaultNotificationRules
+	}
+	ret := NotificationRules{rules: rules, tests: make([]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		if rule.Test == "" {
+			continue
+		}
+		test, err := regexp.Compile(rule.Test)
+		if err != nil {
+			return nil, fmt.Errorf("invalid test regex in notification rule %d: %s", i+1, err)
+		}
+		ret.tests[i] = test
+	}
+	return &ret, nil
+}
+
+// ParseNotificationRule parses a rule from its single-line representation, e.g. "states=failed,incomplete test=^textmode remote=openqa.opensuse.org notifiers=webhook".
+// Lists are comma-separated. The "ignore" keyword marks the rule as ignore rule
+func ParseNotificationRule(text string) (NotificationRule, error) {
+	var rule NotificationRule
+	var err error
+	for _, field := range strings.Fields(text) {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			if strings.ToLower(field) == "ignore" {
+				rule.Ignore = true
+				continue
+			}
+			return rule, fmt.Errorf("invalid rule field: %s", field)
+		}
+		name, value := strings.ToLower(field[:i]), field[i+1:]
+		switch name {
+		case "state", "states":
+			rule.States = splitList(value)
+		case "result", "results":
+			rule.Results = splitList(value)
+		case "test":
+			rule.Test = value
+		case "remote":
+			rule.Remote = value
+		case "notifier", "notifiers":
+			rule.Notifiers = splitList(value)
+		case "ignore":
+			if rule.Ignore, err = strconv.ParseBool(value); err != nil {
+				return rule, fmt.Errorf("invalid ignore value: %s", value)
+			}
+		default:
+			return rule, fmt.Errorf("invalid rule field: %s", name)
+		}
+	}
+	return rule, nil
+}
+
+// Match returns the first rule matching the given job and true, or false if no rule matches
+func (rules *NotificationRules) Match(job gopenqa.Job) (NotificationRule, bool) {
+	for i, rule := range rules.rules {
+		if len(rule.States) > 0 && !contains(rule.States, job.JobState()) && !contains(rule.States, job.State) {
+			continue
+		}
+		if len(rule.Results) > 0 && !contains(rule.Results, job.Result) {
+			continue
+		}
+		if rules.tests[i] != nil && !rules.tests[i].MatchString(job.Test) {
+			continue
+		}
+		if rule.Remote != "" && Hostname(rule.Remote) != Hostname(job.Remote) {
+			continue
+		}
+		return rule, true
+	}
+	return NotificationRule{}, false
+}
+
+// Notify returns true if notifications about the given job should be sent, and the backends to send them to (empty means all backends)
+func (rules *NotificationRules) Notify(job gopenqa.Job) (bool, []string) {
+	rule, ok := rules.Match(job)
+	if !ok || rule.Ignore {
+		return false, nil
+	}
+	return true, rule.Notifiers
+}
+
+// Split a comma-separated list, ignoring empty entries
+func splitList(value string) []string {
+	ret := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}